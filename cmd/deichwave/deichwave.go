@@ -130,6 +130,15 @@ func main() {
 		}).Error("Could not set initial light effect")
 	}
 
+	// Choose where the audio is played, usually on the speaker
+	err = common.InitSink(&cfg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"sink": cfg.Audio.Sink,
+			"err":  err,
+		}).Error("Could not set up the audio sink")
+	}
+
 	// Prepare the music command module and initialize the speaker
 	musicPlayer, err := music.NewPlayer("music-rest", &cfg)
 	if err != nil {
@@ -139,6 +148,25 @@ func main() {
 	} else {
 		log.Info("Player setup complete")
 	}
+
+	// Restore the volumes of the last run
+	common.InitVolumes(&cfg)
+
+	// Set up the equaliser and limiter of the master output
+	err = common.InitOutput(&cfg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Could not set up the output processing")
+	}
+
+	// Route music and sounds to the speakers
+	err = common.InitRouting(&cfg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Could not set up the speaker routing")
+	}
 	log.Info("Gathering music files...")
 
 	// Gather the music files
@@ -153,6 +181,12 @@ func main() {
 			"num": musicPlayer.ListPlaylists(),
 		}).Info("Loaded playlists")
 	}
+	err = musicPlayer.CheckChances()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Playlist chances do not match the playlists")
+	}
 	musicPlayer.Play()
 
 	// Prepare the sound command module and initialize the speaker
@@ -202,6 +236,17 @@ func main() {
 		Name:   "Deichwave REST Server",
 	})
 
+	// Lower the music while sound effects are playing
+	common.InitDucking(&cfg)
+
+	// Follow the intensity schedule, if there is one
+	err = common.InitSchedule(&cfg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Could not start the intensity schedule")
+	}
+
 	// GPIO Inputs
 	driverGPIO, err := hardware.GetInputDriver("gpio")
 	if err != nil {
@@ -241,5 +286,13 @@ func main() {
 
 	// Stop the API
 	api.Stop()
+
+	// Finish the audio output, e.g. the file of a WAV sink
+	err = common.CloseSink()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("Could not close the audio sink")
+	}
 	log.Info("Closing")
 }
@@ -2,7 +2,7 @@ package common
 
 import (
 	"errors"
-	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/faiface/beep"
@@ -11,33 +11,59 @@ import (
 )
 
 var ErrSpeakerContextReused = errors.New("the speaker was already initialized, the existing context is reused")
+var ErrDeviceNotFound = errors.New("audio device could not be found")
+var ErrDevicesUnsupported = errors.New("audio devices can not be selected on this platform")
 var initialized int
 var mixer *beep.Mixer
+var musicMixer *beep.Mixer
+var soundsMixer *beep.Mixer
 var volumeLevel int
 var volumeStream *effects.Volume
-var intensityLevel int
+var intensityLevel atomic.Int32 // Set by the schedule while being read elsewhere
 
-func GetSpeaker(rate beep.SampleRate, buffersize int, volume int) (int, error) {
-	if initialized == 0 {
-		err := speaker.Init(rate, buffersize)
-		if err != nil {
-			return 0, err
-		}
+// An output device of the sound system, an empty ID stands for the system
+// default
+type AudioDevice struct {
+	ID   string
+	Name string
+}
 
-		initialized = rate.N(time.Second)
-		return initialized, nil
+func GetSpeaker(rate beep.SampleRate, buffersize int, volume int, dev string) (int, error) {
+	if initialized != 0 {
+		return initialized, ErrSpeakerContextReused
+	}
+	if sink == nil {
+		sink = &speakerSink{device: dev}
+	}
+	err := sink.Open(rate, buffersize)
+	if err != nil {
+		return 0, err
 	}
+	initialized = rate.N(time.Second)
+
+	// Music and sounds are mixed separately, so that they have their own volume
+	// and the music can be ducked
+	musicMixer = &beep.Mixer{}
+	soundsMixer = &beep.Mixer{}
+	duck = newDucker(musicMixer)
 	mixer = &beep.Mixer{}
+	mixer.Add(newRouteStream(ChannelMusic, "", newChannelStream(ChannelMusic, duck)), newChannelStream(ChannelSounds, soundsMixer))
+
+	// The master bus is equalised and split up for the speakers before the
+	// volume is applied, the limiter comes last so that nothing can clip
+	eq = &equaliser{Streamer: mixer}
+	cross = &crossover{Streamer: eq}
 	volumeStream = &effects.Volume{
-		Streamer: mixer,
+		Streamer: cross,
 		Base:     2,
 		Volume:   1,
 		Silent:   true,
 	}
-	SetIntensity(0)
+	setIntensity(0)
 	SetVolume(volume)
-	speaker.Play(volumeStream)
-	return initialized, ErrSpeakerContextReused
+	limit = newLimiter(volumeStream)
+	sink.Play(limit)
+	return initialized, nil
 }
 
 func Play(streamers ...beep.Streamer) {
@@ -46,19 +72,39 @@ func Play(streamers ...beep.Streamer) {
 	speaker.Unlock()
 }
 
+// PlayMusic mixes the streamers into the music, which is ducked while sound
+// effects are playing
+func PlayMusic(streamers ...beep.Streamer) {
+	speaker.Lock()
+	musicMixer.Add(streamers...)
+	speaker.Unlock()
+}
+
+// PlaySound mixes the streamer of a sound effect into the outputs it is routed
+// to and ducks the music until it has ended, if the sound is supposed to do so
+func PlaySound(name string, streamer beep.Streamer) {
+	speaker.Lock()
+	defer speaker.Unlock()
+	streamer = newRouteStream(ChannelSounds, name, streamer)
+	if duck.ducks(name) {
+		duck.active += 1
+		streamer = &duckTrigger{Streamer: streamer}
+	}
+	soundsMixer.Add(streamer)
+}
+
 func SetVolume(volume int) {
 	if volume > 100 {
 		volume = 100
 	} else if volume < 1 {
 		volume = 1
 	}
+	speaker.Lock()
 	volumeLevel = volume
-	if volume == 0 {
-		volumeStream.Silent = true
-	} else {
-		volumeStream.Silent = false
-		volumeStream.Volume = math.Log2(float64(volume) / 100)
-	}
+	ApplyVolume(volumeStream, volume)
+	speaker.Unlock()
+
+	saveVolumes()
 	EventFire(Event{
 		Origin: "audio",
 		Type:   "volume",
@@ -73,13 +119,20 @@ func GetVolume() int {
 	return volumeLevel
 }
 
+// SetIntensity changes the intensity manually, which suspends the intensity
+// schedule for a while
 func SetIntensity(intensity int) {
+	setIntensity(intensity)
+	schedule.suspend()
+}
+
+func setIntensity(intensity int) {
 	if intensity > 100 {
 		intensity = 100
 	} else if intensity < 0 {
 		intensity = 0
 	}
-	intensityLevel = intensity
+	intensityLevel.Store(int32(intensity))
 	EventFire(Event{
 		Origin: "audio",
 		Type:   "intensity",
@@ -87,9 +140,55 @@ func SetIntensity(intensity int) {
 }
 
 func ChangeIntensity(delta int) {
-	SetIntensity(intensityLevel + delta)
+	SetIntensity(GetIntensity() + delta)
 }
 
 func GetIntensity() int {
-	return intensityLevel
+	return int(intensityLevel.Load())
+}
+
+// ListDevices returns the output devices that can be selected.
+func ListDevices() ([]AudioDevice, error) {
+	return listDevices()
+}
+
+// GetDevice returns the selected output device, empty for the system default.
+func GetDevice() string {
+	if s, ok := sink.(*speakerSink); ok {
+		return s.getDevice()
+	}
+	return ""
+}
+
+// SetDevice moves the output to another device while it is playing, the
+// streamers stay the same so that nothing is lost but a short gap.
+func SetDevice(id string) error {
+	s, ok := sink.(*speakerSink)
+	if !ok || initialized == 0 {
+		return ErrDevicesUnsupported
+	}
+	if id != "" {
+		devices, err := listDevices()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, dev := range devices {
+			found = found || dev.ID == id
+		}
+		if !found {
+			return ErrDeviceNotFound
+		}
+	}
+
+	err := s.switchDevice(id)
+	if err != nil {
+		return err
+	}
+	EventFire(Event{
+		Origin: "audio",
+		Name:   id,
+		Type:   "device",
+	})
+	return nil
 }
@@ -14,23 +14,65 @@ type Config struct {
 	File  string `env:"CONFIG" env-default:"config/default.toml"`
 	Debug bool   `env:"DEBUG" env-default:"false"`
 	Audio struct {
-		Rate    int `toml:"rate" env:"RATE" env-default:"44100"`
-		Buffer  int `toml:"buffer" env:"BUFFER" env-default:"5000"`
-		Quality int `toml:"quality" env:"QUALITY" env-default:"6"`
-		Volume  int `toml:"volume" env:"VOLUME" env-default:"10"`
+		Rate             int    `toml:"rate" env:"RATE" env-default:"44100"`
+		Buffer           int    `toml:"buffer" env:"BUFFER" env-default:"5000"`
+		Device           string `toml:"device" env:"DEVICE" env-default:""`
+		Sink             string `toml:"sink" env:"SINK" env-default:"speaker"`
+		SinkFile         string `toml:"sink_file" env:"SINK_FILE" env-default:"data/output.wav"`
+		Quality          int    `toml:"quality" env:"QUALITY" env-default:"6"`
+		Volume           int    `toml:"volume" env:"VOLUME" env-default:"10"`
+		Volumes          string `toml:"volumes" env:"VOLUMES" env-default:"data/volumes.json"`
+		ScheduleOverride int    `toml:"schedule_override" env:"SCHEDULE_OVERRIDE" env-default:"600"`
 	} `toml:"audio" env-prefix:"AUDIO_"`
-	Sounds struct {
-		Path       string `toml:"path" env:"DIR" env-default:"data/sounds/effects"`
-		Ext        string `toml:"ext" env:"EXT" env-default:".ogg"`
-		Randomizer string `toml:"randomizer" env:"RND" env-default:".random"`
-		Volume     int    `toml:"volume" env:"VOLUME" env-default:"100"`
+	Output struct {
+		EQ             []EQBand `toml:"eq"`
+		BassBoost      float64  `toml:"bass_boost" env:"BASS_BOOST" env-default:"0"`
+		BassBoostFreq  float64  `toml:"bass_boost_freq" env:"BASS_BOOST_FREQ" env-default:"80"`
+		Limiter        bool     `toml:"limiter" env:"LIMITER" env-default:"true"`
+		LimiterCeiling float64  `toml:"limiter_ceiling" env:"LIMITER_CEILING" env-default:"-1"`
+		LimiterRelease int      `toml:"limiter_release" env:"LIMITER_RELEASE" env-default:"100"`
+	} `toml:"output" env-prefix:"OUTPUT_"`
+	Routing struct {
+		Outputs     []RoutingOutput     `toml:"outputs"`
+		Music       []string            `toml:"music"`
+		Sounds      []string            `toml:"sounds"`
+		SoundRoutes map[string][]string `toml:"sound_routes"`
+	} `toml:"routing"`
+	Schedule []ScheduleEntry `toml:"schedule"`
+	Sounds   struct {
+		Path           string   `toml:"path" env:"DIR" env-default:"data/sounds/effects"`
+		Ext            string   `toml:"ext" env:"EXT" env-default:".ogg"`
+		Randomizer     string   `toml:"randomizer" env:"RND" env-default:".random"`
+		Volume         int      `toml:"volume" env:"VOLUME" env-default:"100"`
+		Ducking        float64  `toml:"ducking" env:"DUCKING" env-default:"9"`
+		DuckingAttack  int      `toml:"ducking_attack" env:"DUCKING_ATTACK" env-default:"50"`
+		DuckingRelease int      `toml:"ducking_release" env:"DUCKING_RELEASE" env-default:"500"`
+		DuckingSounds  []string `toml:"ducking_sounds" env:"DUCKING_SOUNDS"`
 	} `toml:"sounds" env-prefix:"SOUNDS_"`
 	Music struct {
-		Path     string `toml:"path" env:"DIR" env-default:"data/music/playlists"`
-		Ext      string `toml:"ext" env:"EXT" env-default:".ogg"`
-		Volume   int    `toml:"volume" env:"VOLUME" env-default:"50"`
-		StartRNG []int  `toml:"startrng" env:"STARTRNG" env-default:"95,5"`
-		EndRNG   []int  `toml:"endrng" env:"ENDRNG" env-default:"30,70"`
+		Path             string   `toml:"path" env:"DIR" env-default:"data/music/playlists"`
+		Ordered          string   `toml:"ordered" env:"ORDERED" env-default:".ordered"`
+		Single           string   `toml:"single" env:"SINGLE" env-default:".single"`
+		Ext              []string `toml:"ext" env:"EXT" env-default:".ogg"`
+		Volume           int      `toml:"volume" env:"VOLUME" env-default:"50"`
+		Crossfade        int      `toml:"crossfade" env:"CROSSFADE" env-default:"0"`
+		Fade             int      `toml:"fade" env:"FADE" env-default:"250"`
+		Normalize        bool     `toml:"normalize" env:"NORMALIZE" env-default:"true"`
+		Loudness         string   `toml:"loudness" env:"LOUDNESS" env-default:"data/music/loudness.json"`
+		Analysis         string   `toml:"analysis" env:"ANALYSIS" env-default:"data/music/analysis.json"`
+		EnergyWindow     int      `toml:"energy_window" env:"ENERGY_WINDOW" env-default:"5"`
+		ArtistSeparation int      `toml:"artist_separation" env:"ARTIST_SEPARATION" env-default:"3"`
+		TitleSeparation  int      `toml:"title_separation" env:"TITLE_SEPARATION" env-default:"30"`
+		History          string   `toml:"history" env:"HISTORY" env-default:"data/music/history.json"`
+		HistorySize      int      `toml:"history_size" env:"HISTORY_SIZE" env-default:"100"`
+		StartRNG         []int    `toml:"startrng" env:"STARTRNG" env-default:"95,5"`
+		EndRNG           []int    `toml:"endrng" env:"ENDRNG" env-default:"30,70"`
+		Playlists        map[string]struct {
+			Start *int    `toml:"start"`
+			End   *int    `toml:"end"`
+			Curve [][]int `toml:"curve"`
+			Mode  string  `toml:"mode"`
+		} `toml:"playlists"`
 	} `toml:"music" env-prefix:"MUSIC_"`
 	Lights struct {
 		Path string `toml:"path" env:"DIR" env-default:"data/lights/effects"`
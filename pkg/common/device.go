@@ -0,0 +1,14 @@
+//go:build !linux
+
+package common
+
+func listDevices() ([]AudioDevice, error) {
+	return nil, ErrDevicesUnsupported
+}
+
+func selectDevice(id string) error {
+	if id != "" {
+		return ErrDevicesUnsupported
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Lines of /proc/asound/cards that start a card, e.g.
+// " 1 [Device         ]: USB-Audio - USB Audio Device"
+var alsaCard = regexp.MustCompile(`^\s*(\d+)\s+\[(.+?)\s*\]:\s*(.*?)\s+-\s+(.*)$`)
+
+// listDevices returns the ALSA sound cards
+func listDevices() ([]AudioDevice, error) {
+	file, err := os.Open("/proc/asound/cards")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	devices := make([]AudioDevice, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		match := alsaCard.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		devices = append(devices, AudioDevice{
+			ID:   match[2],
+			Name: strings.TrimSpace(match[4]),
+		})
+	}
+	return devices, scanner.Err()
+}
+
+// selectDevice points the default ALSA device, which is the one the speaker
+// opens, to a sound card, the variable is read again whenever it is opened
+func selectDevice(id string) error {
+	if id == "" {
+		return os.Unsetenv("ALSA_CARD")
+	}
+	return os.Setenv("ALSA_CARD", id)
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"math"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+)
+
+// The ducker lowers the music while sound effects are playing, so that they
+// are not drowned out by it. The gain moves towards the ducked level with the
+// attack time and back with the release time
+type ducker struct {
+	Streamer beep.Streamer
+	gain     float64
+	level    float64         // Gain of the ducked music
+	attack   float64         // Gain change per sample while ducking
+	release  float64         // Gain change per sample while restoring
+	sounds   map[string]bool // Sounds that duck the music, all if empty
+	active   int             // Number of ducking sounds that are playing
+}
+
+var duck *ducker
+
+func newDucker(streamer beep.Streamer) *ducker {
+	return &ducker{Streamer: streamer, gain: 1, level: 1, attack: 1, release: 1}
+}
+
+func (d *ducker) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = d.Streamer.Stream(samples)
+	target := 1.0
+	if d.active > 0 {
+		target = d.level
+	}
+	for i := range samples[:n] {
+		if d.gain > target {
+			d.gain = math.Max(target, d.gain-d.attack)
+		} else if d.gain < target {
+			d.gain = math.Min(target, d.gain+d.release)
+		}
+		samples[i][0] *= d.gain
+		samples[i][1] *= d.gain
+	}
+	return n, ok
+}
+
+func (d *ducker) Err() error {
+	return d.Streamer.Err()
+}
+
+// ducks checks if a sound should duck the music
+func (d *ducker) ducks(name string) bool {
+	return d.level < 1 && (len(d.sounds) == 0 || d.sounds[name])
+}
+
+// duckTrigger keeps the music ducked until the sound it wraps has ended, must
+// only be streamed while holding the speaker lock, which the mixer does
+type duckTrigger struct {
+	Streamer beep.Streamer
+	done     bool
+}
+
+func (t *duckTrigger) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = t.Streamer.Stream(samples)
+	if !ok && !t.done {
+		t.done = true
+		duck.active -= 1
+	}
+	return n, ok
+}
+
+func (t *duckTrigger) Err() error {
+	return t.Streamer.Err()
+}
+
+// InitDucking configures by how much the music is lowered while sound effects
+// are playing, and which of them do so.
+func InitDucking(cfg *Config) {
+	configureDucking(cfg)
+	ConfigChangeListener(func() {
+		configureDucking(cfg)
+	})
+}
+
+func configureDucking(cfg *Config) {
+	if duck == nil {
+		return
+	}
+	level := math.Pow(10, -math.Max(0, cfg.Sounds.Ducking)/20)
+	sounds := make(map[string]bool, len(cfg.Sounds.DuckingSounds))
+	for _, name := range cfg.Sounds.DuckingSounds {
+		sounds[name] = true
+	}
+
+	speaker.Lock()
+	defer speaker.Unlock()
+	duck.level = level
+	duck.attack = rampStep(1-level, time.Duration(cfg.Sounds.DuckingAttack)*time.Millisecond)
+	duck.release = rampStep(1-level, time.Duration(cfg.Sounds.DuckingRelease)*time.Millisecond)
+	duck.sounds = sounds
+}
+
+// rampStep returns the change per sample needed to ramp a gain by the given
+// amount in the given time
+func rampStep(amount float64, duration time.Duration) float64 {
+	samples := float64(initialized) * duration.Seconds()
+	if samples < 1 || amount <= 0 {
+		return 1
+	}
+	return amount / samples
+}
@@ -3,37 +3,43 @@ package common
 import (
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Event struct {
-	Origin string `json:"origin"`
-	Name   string `json:"name"`
-	Type   string `json:"type"`
+	Origin string      `json:"origin"`
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Data   interface{} `json:"data,omitempty"`
 }
 
-var ready bool
+var ready atomic.Bool
 var queue chan Event
 var listeners []func(Event)
+var listenersLock sync.RWMutex
 
 func EventFire(ev Event) {
 	log.WithFields(log.Fields{
 		"event": ev,
-		"ready": ready,
+		"ready": ready.Load(),
 	}).Debug("Event fired")
-	if ready {
+	if ready.Load() {
 		queue <- ev
 	}
 }
 
 func EventListen(listener func(Event)) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
 	listeners = append(listeners, listener)
 }
 
 func EventLoop() {
 	queue = make(chan Event)
-	ready = true
+	ready.Store(true)
 	log.Debug("Eventloop started")
 
 	for ev := range queue {
@@ -41,7 +47,11 @@ func EventLoop() {
 			"event": ev,
 		}).Debug("Event received")
 
-		for _, listener := range listeners {
+		// Listeners may be added while the loop is running
+		listenersLock.RLock()
+		current := listeners
+		listenersLock.RUnlock()
+		for _, listener := range current {
 			listener(ev)
 		}
 	}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// resetListeners drops all listeners that are registered during the test,
+// once it is done
+func resetListeners(t *testing.T) {
+	listenersLock.RLock()
+	previous := listeners
+	listenersLock.RUnlock()
+	t.Cleanup(func() {
+		listenersLock.Lock()
+		listeners = previous
+		listenersLock.Unlock()
+	})
+}
+
+// runEventLoop starts the event loop and stops it again once the test is
+// done, listeners have to be registered before
+func runEventLoop(t *testing.T) {
+	t.Helper()
+	done := make(chan bool)
+	go func() {
+		EventLoop()
+		close(done)
+	}()
+	for !ready.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	t.Cleanup(func() {
+		ready.Store(false)
+		close(queue)
+		<-done
+	})
+}
+
+// fireWithin fires an event and fails the test if it is not taken by the
+// event loop in time
+func fireWithin(t *testing.T, ev Event, timeout time.Duration) {
+	t.Helper()
+	fired := make(chan bool)
+	go func() {
+		EventFire(ev)
+		close(fired)
+	}()
+	select {
+	case <-fired:
+	case <-time.After(timeout):
+		t.Fatalf("the event loop did not take the %s/%s event", ev.Origin, ev.Type)
+	}
+}
+
+func TestEventLoop(t *testing.T) {
+	resetListeners(t)
+	received := make(chan Event, 1)
+	EventListen(func(ev Event) {
+		received <- ev
+	})
+	runEventLoop(t)
+
+	fireWithin(t, Event{Origin: "test", Type: "ping"}, time.Second)
+	select {
+	case ev := <-received:
+		if ev.Origin != "test" || ev.Type != "ping" {
+			t.Errorf("listener received %s/%s, want test/ping", ev.Origin, ev.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("listener did not receive the event")
+	}
+}
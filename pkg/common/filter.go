@@ -0,0 +1,82 @@
+package common
+
+import (
+	"errors"
+	"math"
+
+	"github.com/faiface/beep"
+)
+
+// Filter types that can be created by NewBiquad, following the Audio EQ
+// Cookbook by Robert Bristow-Johnson
+const (
+	FilterPeak      = "peak"
+	FilterLowShelf  = "lowshelf"
+	FilterHighShelf = "highshelf"
+	FilterLowPass   = "lowpass"
+	FilterHighPass  = "highpass"
+)
+
+var ErrFilterInvalid = errors.New("filters need a known type, a frequency below half the sample rate and a positive q")
+
+// Biquad is a second order IIR filter in direct form I
+type Biquad struct {
+	B0, B1, B2, A1, A2 float64
+	x1, x2, y1, y2     float64
+}
+
+// NewBiquad creates a filter of the given type at a frequency in Hz, the gain
+// in dB is only used by peak and shelf filters
+func NewBiquad(kind string, rate beep.SampleRate, freq float64, q float64, gain float64) (Biquad, error) {
+	if freq <= 0 || freq >= float64(rate)/2 || q <= 0 {
+		return Biquad{}, ErrFilterInvalid
+	}
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * freq / float64(rate)
+	cos := math.Cos(w0)
+	alpha := math.Sin(w0) / (2 * q)
+	sqrtA := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch kind {
+	case FilterPeak:
+		b0, b1, b2 = 1+alpha*a, -2*cos, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cos, 1-alpha/a
+	case FilterLowShelf:
+		b0 = a * ((a + 1) - (a-1)*cos + sqrtA)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - sqrtA)
+		a0 = (a + 1) + (a-1)*cos + sqrtA
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - sqrtA
+	case FilterHighShelf:
+		b0 = a * ((a + 1) + (a-1)*cos + sqrtA)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - sqrtA)
+		a0 = (a + 1) - (a-1)*cos + sqrtA
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - sqrtA
+	case FilterLowPass:
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case FilterHighPass:
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	default:
+		return Biquad{}, ErrFilterInvalid
+	}
+	return Biquad{B0: b0 / a0, B1: b1 / a0, B2: b2 / a0, A1: a1 / a0, A2: a2 / a0}, nil
+}
+
+func (f *Biquad) Process(x float64) float64 {
+	y := f.B0*x + f.B1*f.x1 + f.B2*f.x2 - f.A1*f.y1 - f.A2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// retune takes over the coefficients of another filter but keeps its own
+// state, so that it can be changed while it is running without a click
+func (f *Biquad) retune(other Biquad) {
+	f.B0, f.B1, f.B2, f.A1, f.A2 = other.B0, other.B1, other.B2, other.A1, other.A2
+}
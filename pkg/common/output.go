@@ -0,0 +1,241 @@
+package common
+
+import (
+	"math"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+	log "github.com/sirupsen/logrus"
+)
+
+// The limiter looks ahead a few milliseconds, so that it can lower the gain
+// before a peak reaches the output
+const limiterLookahead = 5 * time.Millisecond
+
+// A band of the equaliser on the master bus
+type EQBand struct {
+	Type string  `toml:"type"`
+	Freq float64 `toml:"freq"` // [Hz]
+	Gain float64 `toml:"gain"` // [dB]
+	Q    float64 `toml:"q"`
+}
+
+// OutputSettings describe the processing of the master bus, which consists
+// of the equaliser bands, the bass boost and the limiter
+type OutputSettings struct {
+	EQ             []EQBand
+	BassBoost      float64 // [dB]
+	BassBoostFreq  float64 // [Hz]
+	Limiter        bool
+	LimiterCeiling float64 // [dBFS]
+	LimiterRelease int     // [ms]
+}
+
+var output OutputSettings
+var eq *equaliser
+var limit *limiter
+
+// InitOutput sets up the processing of the master bus from the config.
+func InitOutput(cfg *Config) error {
+	ConfigChangeListener(func() {
+		err := setOutput(outputSettings(cfg))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Could not set up the output processing")
+			return
+		}
+		// Listeners run inside the event loop, which can not take another
+		// event until they return
+		go outputChanged()
+	})
+	return SetOutput(outputSettings(cfg))
+}
+
+func outputSettings(cfg *Config) OutputSettings {
+	return OutputSettings{
+		EQ:             cfg.Output.EQ,
+		BassBoost:      cfg.Output.BassBoost,
+		BassBoostFreq:  cfg.Output.BassBoostFreq,
+		Limiter:        cfg.Output.Limiter,
+		LimiterCeiling: cfg.Output.LimiterCeiling,
+		LimiterRelease: cfg.Output.LimiterRelease,
+	}
+}
+
+// GetOutput returns the current processing of the master bus.
+func GetOutput() OutputSettings {
+	speaker.Lock()
+	defer speaker.Unlock()
+	settings := output
+	settings.EQ = append([]EQBand{}, output.EQ...)
+	return settings
+}
+
+// SetOutput changes the processing of the master bus while it is running,
+// filters that keep their type keep their state so that they do not click.
+func SetOutput(settings OutputSettings) error {
+	err := setOutput(settings)
+	if err != nil {
+		return err
+	}
+	outputChanged()
+	return nil
+}
+
+func setOutput(settings OutputSettings) error {
+	if eq == nil || limit == nil {
+		return nil
+	}
+	rate := beep.SampleRate(initialized)
+	bands := append([]EQBand{}, settings.EQ...)
+	if settings.BassBoost != 0 {
+		bands = append(bands, EQBand{Type: FilterLowShelf, Freq: settings.BassBoostFreq, Gain: settings.BassBoost})
+	}
+	filters := make([]Biquad, len(bands))
+	for idx, band := range bands {
+		q := band.Q
+		if q == 0 {
+			q = math.Sqrt2 / 2
+		}
+		filter, err := NewBiquad(band.Type, rate, band.Freq, q, band.Gain)
+		if err != nil {
+			return err
+		}
+		filters[idx] = filter
+	}
+
+	speaker.Lock()
+	output = settings
+	output.EQ = append([]EQBand{}, settings.EQ...)
+	eq.retune(bands, filters)
+	limit.configure(settings, rate)
+	speaker.Unlock()
+	return nil
+}
+
+func outputChanged() {
+	EventFire(Event{
+		Origin: "audio",
+		Type:   "output",
+	})
+}
+
+// The equaliser applies a chain of filters to both channels
+type equaliser struct {
+	Streamer beep.Streamer
+	types    []string
+	filters  [][2]Biquad
+}
+
+func (e *equaliser) retune(bands []EQBand, filters []Biquad) {
+	for idx, filter := range filters {
+		if idx < len(e.filters) && e.types[idx] == bands[idx].Type {
+			e.filters[idx][0].retune(filter)
+			e.filters[idx][1].retune(filter)
+			continue
+		}
+		if idx >= len(e.filters) {
+			e.filters = append(e.filters, [2]Biquad{})
+			e.types = append(e.types, "")
+		}
+		e.filters[idx] = [2]Biquad{filter, filter}
+		e.types[idx] = bands[idx].Type
+	}
+	e.filters = e.filters[:len(filters)]
+	e.types = e.types[:len(filters)]
+}
+
+func (e *equaliser) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = e.Streamer.Stream(samples)
+	for idx := range e.filters {
+		filter := &e.filters[idx]
+		for i := range samples[:n] {
+			samples[i][0] = filter[0].Process(samples[i][0])
+			samples[i][1] = filter[1].Process(samples[i][1])
+		}
+	}
+	return n, ok
+}
+
+func (e *equaliser) Err() error {
+	return e.Streamer.Err()
+}
+
+// The limiter keeps the output below its ceiling, it delays the signal by the
+// lookahead and holds the gain needed for the loudest sample within it, the
+// gain is lowered fast enough to reach it before that sample is played and
+// then released slowly
+type limiter struct {
+	Streamer  beep.Streamer
+	enabled   bool
+	ceiling   float64
+	attack    float64 // Gain change per sample while lowering the gain
+	release   float64 // Share of the remaining gain change per sample while releasing
+	delay     [][2]float64
+	pos       int
+	gain      float64
+	hold      float64
+	holdCount int
+}
+
+func newLimiter(streamer beep.Streamer) *limiter {
+	return &limiter{Streamer: streamer, ceiling: 1, gain: 1, hold: 1}
+}
+
+func (l *limiter) configure(settings OutputSettings, rate beep.SampleRate) {
+	l.enabled = settings.Limiter
+	l.ceiling = math.Pow(10, math.Min(0, settings.LimiterCeiling)/20)
+	lookahead := max(1, rate.N(limiterLookahead))
+	if len(l.delay) != lookahead {
+		l.delay = make([][2]float64, lookahead)
+		l.pos = 0
+	}
+	l.attack = 1 / float64(lookahead)
+	release := float64(rate.N(time.Duration(settings.LimiterRelease) * time.Millisecond))
+	l.release = 1
+	if release > 1 {
+		l.release = 1 - math.Exp(-1/release)
+	}
+}
+
+func (l *limiter) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = l.Streamer.Stream(samples)
+	if !l.enabled {
+		return n, ok
+	}
+	for i := range samples[:n] {
+		// Hold the gain needed for the loudest sample in the lookahead
+		peak := math.Max(math.Abs(samples[i][0]), math.Abs(samples[i][1]))
+		needed := 1.0
+		if peak > l.ceiling {
+			needed = l.ceiling / peak
+		}
+		l.holdCount--
+		if needed <= l.hold || l.holdCount <= 0 {
+			l.hold = needed
+			l.holdCount = len(l.delay)
+		}
+
+		if l.gain > l.hold {
+			l.gain = math.Max(l.hold, l.gain-l.attack)
+		} else {
+			l.gain += (l.hold - l.gain) * l.release
+		}
+
+		delayed := l.delay[l.pos]
+		l.delay[l.pos] = samples[i]
+		l.pos = (l.pos + 1) % len(l.delay)
+		for c := range delayed {
+			// Clip whatever is left, e.g. while the gain is released
+			delayed[c] = math.Max(-l.ceiling, math.Min(l.ceiling, delayed[c]*l.gain))
+		}
+		samples[i] = delayed
+	}
+	return n, ok
+}
+
+func (l *limiter) Err() error {
+	return l.Streamer.Err()
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+func TestOutputConfigChange(t *testing.T) {
+	var cfg Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatalf("could not read the default config: %v", err)
+	}
+	resetListeners(t)
+	setupSink(t, NewNullSink())
+	if err := InitOutput(&cfg); err != nil {
+		t.Fatalf("InitOutput() failed: %v", err)
+	}
+	changed := make(chan bool, 1)
+	EventListen(func(ev Event) {
+		if ev.Origin == "audio" && ev.Type == "output" {
+			changed <- true
+		}
+	})
+	runEventLoop(t)
+
+	// Applying the changed config must not block the event loop, which would
+	// keep every later event from being fired
+	cfg.Output.BassBoost = 6
+	fireWithin(t, Event{Origin: "config", Type: "changed"}, time.Second)
+	fireWithin(t, Event{Origin: "test", Type: "ping"}, time.Second)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatalf("the change of the output was not announced")
+	}
+	if got := GetOutput().BassBoost; got != 6 {
+		t.Errorf("bass boost after the config change = %v, want 6", got)
+	}
+}
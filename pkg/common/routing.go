@@ -0,0 +1,232 @@
+package common
+
+import (
+	"errors"
+	"math"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+	log "github.com/sirupsen/logrus"
+)
+
+// The speaker backend mixes and plays everything as stereo samples, so at
+// most two outputs can be routed to, e.g. the main speakers and a subwoofer
+// behind a crossover. More channels would need a backend that opens devices
+// with more than two channels
+const outputChannels = 2
+
+// Sources an output can take from the stereo signal of music and sounds
+const (
+	SourceLeft  = "left"
+	SourceRight = "right"
+	SourceMono  = "mono"
+)
+
+var ErrRoutingChannels = errors.New("the audio backend only supports two output channels")
+var ErrRoutingOutput = errors.New("routes need known output names, and outputs need a known source")
+
+// An output channel of the speaker, e.g. the main speakers or a subwoofer
+// behind a crossover
+type RoutingOutput struct {
+	Name      string  `toml:"name"`
+	Source    string  `toml:"source"`
+	Crossover string  `toml:"crossover"`
+	Freq      float64 `toml:"freq"` // [Hz]
+}
+
+// The routing table decides which outputs music and sounds are played on,
+// the masks are indexed by output channel
+type routingTable struct {
+	sources []string
+	music   []bool
+	sounds  []bool
+	routes  map[string][]bool // Sounds with their own outputs
+}
+
+var routing = defaultRouting()
+var cross *crossover
+
+func defaultRouting() routingTable {
+	return routingTable{
+		sources: []string{SourceLeft, SourceRight},
+		music:   []bool{true, true},
+		sounds:  []bool{true, true},
+	}
+}
+
+// mask returns the outputs a bus, or a single sound on it, is played on
+func (t *routingTable) mask(bus string, name string) []bool {
+	if bus == ChannelMusic {
+		return t.music
+	}
+	if route, ok := t.routes[name]; ok {
+		return route
+	}
+	return t.sounds
+}
+
+// InitRouting sets up the output channels and which of them music and sounds
+// are played on.
+func InitRouting(cfg *Config) error {
+	ConfigChangeListener(func() {
+		err := configureRouting(cfg)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Could not set up the speaker routing")
+		}
+	})
+	return configureRouting(cfg)
+}
+
+func configureRouting(cfg *Config) error {
+	// The config is checked even without a speaker, so that mistakes in it
+	// are reported right away
+	rate := beep.SampleRate(initialized)
+	if rate == 0 {
+		rate = beep.SampleRate(cfg.Audio.Rate)
+	}
+	table, filters, err := buildRouting(cfg, rate)
+	if err != nil || cross == nil {
+		return err
+	}
+
+	speaker.Lock()
+	routing = table
+	cross.filters = filters
+	speaker.Unlock()
+	return nil
+}
+
+// buildRouting validates the routing config and creates the routing table and
+// the crossover filters of each output from it
+func buildRouting(cfg *Config, rate beep.SampleRate) (routingTable, [][]Biquad, error) {
+	outputs := cfg.Routing.Outputs
+	if len(outputs) == 0 {
+		outputs = []RoutingOutput{{Name: SourceLeft, Source: SourceLeft}, {Name: SourceRight, Source: SourceRight}}
+	}
+	if len(outputs) > outputChannels {
+		return routingTable{}, nil, ErrRoutingChannels
+	}
+
+	table := routingTable{
+		sources: make([]string, len(outputs)),
+		routes:  make(map[string][]bool, len(cfg.Routing.SoundRoutes)),
+	}
+	filters := make([][]Biquad, len(outputs))
+	names := make(map[string]int, len(outputs))
+	for idx, output := range outputs {
+		switch output.Source {
+		case SourceLeft, SourceRight, SourceMono:
+		default:
+			return routingTable{}, nil, ErrRoutingOutput
+		}
+		table.sources[idx] = output.Source
+		names[output.Name] = idx
+
+		// Crossovers are Linkwitz-Riley filters, i.e. two Butterworth filters
+		// in a row, so that the low and high pass add up to a flat response
+		if output.Crossover != "" {
+			filter, err := NewBiquad(output.Crossover, rate, output.Freq, math.Sqrt2/2, 0)
+			if err != nil {
+				return routingTable{}, nil, err
+			}
+			filters[idx] = []Biquad{filter, filter}
+		}
+	}
+
+	var err error
+	if table.music, err = routingMask(names, cfg.Routing.Music); err != nil {
+		return routingTable{}, nil, err
+	}
+	if table.sounds, err = routingMask(names, cfg.Routing.Sounds); err != nil {
+		return routingTable{}, nil, err
+	}
+	for sound, route := range cfg.Routing.SoundRoutes {
+		if table.routes[sound], err = routingMask(names, route); err != nil {
+			return routingTable{}, nil, err
+		}
+	}
+	return table, filters, nil
+}
+
+// routingMask turns a list of output names into a mask of output channels,
+// an empty list routes to all of them
+func routingMask(names map[string]int, route []string) ([]bool, error) {
+	mask := make([]bool, len(names))
+	for _, name := range route {
+		idx, ok := names[name]
+		if !ok {
+			return nil, ErrRoutingOutput
+		}
+		mask[idx] = true
+	}
+	if len(route) == 0 {
+		for idx := range mask {
+			mask[idx] = true
+		}
+	}
+	return mask, nil
+}
+
+// routeStream plays a stereo stream on the outputs it is routed to, must only
+// be streamed while holding the speaker lock, which the mixer does
+type routeStream struct {
+	Streamer beep.Streamer
+	bus      string
+	name     string
+}
+
+func newRouteStream(bus string, name string, streamer beep.Streamer) *routeStream {
+	return &routeStream{Streamer: streamer, bus: bus, name: name}
+}
+
+func (r *routeStream) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = r.Streamer.Stream(samples)
+	mask := routing.mask(r.bus, r.name)
+	for i := range samples[:n] {
+		left, right := samples[i][0], samples[i][1]
+		for c := range samples[i] {
+			if c >= len(mask) || !mask[c] {
+				samples[i][c] = 0
+				continue
+			}
+			switch routing.sources[c] {
+			case SourceLeft:
+				samples[i][c] = left
+			case SourceRight:
+				samples[i][c] = right
+			case SourceMono:
+				samples[i][c] = (left + right) / 2
+			}
+		}
+	}
+	return n, ok
+}
+
+func (r *routeStream) Err() error {
+	return r.Streamer.Err()
+}
+
+// The crossover filters each output channel for the speaker behind it
+type crossover struct {
+	Streamer beep.Streamer
+	filters  [][]Biquad
+}
+
+func (x *crossover) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = x.Streamer.Stream(samples)
+	for c, filters := range x.filters {
+		for idx := range filters {
+			filter := &filters[idx]
+			for i := range samples[:n] {
+				samples[i][c] = filter.Process(samples[i][c])
+			}
+		}
+	}
+	return n, ok
+}
+
+func (x *crossover) Err() error {
+	return x.Streamer.Err()
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiface/beep"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+func TestConfigureRouting(t *testing.T) {
+	mains := RoutingOutput{Name: "mains", Source: SourceMono, Crossover: FilterHighPass, Freq: 100}
+	sub := RoutingOutput{Name: "sub", Source: SourceMono, Crossover: FilterLowPass, Freq: 100}
+	tests := []struct {
+		name    string
+		outputs []RoutingOutput
+		sounds  []string
+		routes  map[string][]string
+		wantErr error
+	}{
+		{"plain stereo", nil, nil, nil, nil},
+		{"mains and sub", []RoutingOutput{mains, sub}, []string{"mains"}, map[string][]string{"horn": {"mains"}}, nil},
+		{"too many outputs", []RoutingOutput{mains, sub, {Name: "tweeters", Source: SourceMono}}, nil, nil, ErrRoutingChannels},
+		{"unknown source", []RoutingOutput{{Name: "mains", Source: "center"}}, nil, nil, ErrRoutingOutput},
+		{"unknown output", []RoutingOutput{mains, sub}, []string{"tweeters"}, nil, ErrRoutingOutput},
+		{"unknown output of a sound", []RoutingOutput{mains, sub}, nil, map[string][]string{"horn": {"front"}}, ErrRoutingOutput},
+		{"crossover above nyquist", []RoutingOutput{{Name: "sub", Source: SourceMono, Crossover: FilterLowPass, Freq: 30000}}, nil, nil, ErrFilterInvalid},
+		{"unknown crossover", []RoutingOutput{{Name: "sub", Source: SourceMono, Crossover: "bandpass", Freq: 100}}, nil, nil, ErrFilterInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if err := cleanenv.ReadEnv(&cfg); err != nil {
+				t.Fatalf("could not read the default config: %v", err)
+			}
+			cfg.Routing.Outputs = tt.outputs
+			cfg.Routing.Sounds = tt.sounds
+			cfg.Routing.SoundRoutes = tt.routes
+
+			// Mistakes are reported even without a speaker
+			if err := ResetSpeaker(); err != nil {
+				t.Fatalf("could not reset the speaker: %v", err)
+			}
+			if err := configureRouting(&cfg); err != tt.wantErr {
+				t.Errorf("configureRouting() without a speaker = %v, want %v", err, tt.wantErr)
+			}
+
+			setupSink(t, NewNullSink())
+			if err := configureRouting(&cfg); err != tt.wantErr {
+				t.Errorf("configureRouting() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoutingMasks(t *testing.T) {
+	var cfg Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatalf("could not read the default config: %v", err)
+	}
+	cfg.Routing.Outputs = []RoutingOutput{{Name: "front", Source: SourceMono}, {Name: "rear", Source: SourceRight}}
+	cfg.Routing.Sounds = []string{"rear"}
+	cfg.Routing.SoundRoutes = map[string][]string{"horn": {"front"}}
+	table, filters, err := buildRouting(&cfg, beep.SampleRate(44100))
+	if err != nil {
+		t.Fatalf("buildRouting() failed: %v", err)
+	}
+	if len(filters) != 2 || filters[0] != nil || filters[1] != nil {
+		t.Errorf("buildRouting() filters = %v, want none", filters)
+	}
+
+	tests := []struct {
+		bus  string
+		name string
+		want []bool
+	}{
+		{ChannelMusic, "", []bool{true, true}},
+		{ChannelSounds, "bell", []bool{false, true}},
+		{ChannelSounds, "horn", []bool{true, false}},
+	}
+	for _, tt := range tests {
+		if got := table.mask(tt.bus, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mask(%q, %q) = %v, want %v", tt.bus, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrScheduleEmpty = errors.New("schedule has no entries")
+var ErrScheduleInvalid = errors.New("schedule entry needs a time like \"+2h\" or \"18:30\"")
+
+// The schedule checks whether the intensity has to be changed periodically
+const scheduleInterval = time.Second
+
+// ScheduleStatus describes the state of the intensity schedule
+type ScheduleStatus struct {
+	State         string
+	Started       time.Time
+	Target        int
+	Next          time.Time
+	NextIntensity int
+	Resume        time.Time
+}
+
+// The intensity schedule ramps the intensity linearly between its entries,
+// manual changes suspend it for a while before it continues from there
+type intensitySchedule struct {
+	lock      sync.Mutex
+	entries   []ScheduleEntry
+	points    []schedulePoint
+	override  time.Duration
+	started   time.Time
+	running   bool
+	paused    bool
+	suspended time.Time
+	anchor    schedulePoint
+}
+
+// ScheduleEntry is an intensity that has to be reached at a given time
+type ScheduleEntry struct {
+	At        string `toml:"at"`
+	Intensity int    `toml:"intensity"`
+}
+
+type schedulePoint struct {
+	offset    time.Duration
+	intensity int
+}
+
+var schedule intensitySchedule
+
+// InitSchedule loads the intensity schedule from the config and starts it if
+// it has any entries.
+func InitSchedule(cfg *Config) error {
+	schedule.lock.Lock()
+	schedule.entries = cfg.Schedule
+	schedule.override = time.Duration(cfg.Audio.ScheduleOverride) * time.Second
+	schedule.lock.Unlock()
+
+	ConfigChangeListener(func() {
+		schedule.lock.Lock()
+		schedule.entries = cfg.Schedule
+		schedule.override = time.Duration(cfg.Audio.ScheduleOverride) * time.Second
+		err := schedule.resolve()
+		schedule.lock.Unlock()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Error("Could not load the intensity schedule")
+		}
+	})
+
+	go schedule.run()
+	if len(cfg.Schedule) == 0 {
+		return nil
+	}
+	return StartSchedule()
+}
+
+// StartSchedule starts the intensity schedule, or resumes it from the current
+// intensity if it was paused or suspended.
+func StartSchedule() error {
+	schedule.lock.Lock()
+	if len(schedule.entries) == 0 {
+		schedule.lock.Unlock()
+		return ErrScheduleEmpty
+	}
+	now := time.Now()
+	if !schedule.running {
+		schedule.started = now
+		schedule.running = true
+	}
+	schedule.paused = false
+	schedule.suspended = time.Time{}
+	schedule.anchor = schedulePoint{offset: now.Sub(schedule.started), intensity: GetIntensity()}
+	err := schedule.resolve()
+	if err != nil {
+		schedule.running = false
+	}
+	schedule.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Started the intensity schedule")
+	scheduleChanged()
+	return nil
+}
+
+// PauseSchedule stops the intensity schedule from changing the intensity
+// until it is started again.
+func PauseSchedule() {
+	schedule.lock.Lock()
+	schedule.paused = schedule.running
+	schedule.suspended = time.Time{}
+	schedule.lock.Unlock()
+
+	log.Info("Paused the intensity schedule")
+	scheduleChanged()
+}
+
+// GetSchedule returns the current state of the intensity schedule.
+func GetSchedule() ScheduleStatus {
+	schedule.lock.Lock()
+	defer schedule.lock.Unlock()
+
+	status := ScheduleStatus{State: "stopped", Target: GetIntensity()}
+	if !schedule.running {
+		return status
+	}
+	now := time.Now()
+	status.Started = schedule.started
+	status.Target, status.Next, status.NextIntensity = schedule.target(now)
+	switch {
+	case schedule.paused:
+		status.State = "paused"
+	case !schedule.suspended.IsZero():
+		status.State = "suspended"
+		status.Resume = schedule.suspended
+	default:
+		status.State = "running"
+	}
+	return status
+}
+
+// resolve converts the entries into offsets from the start of the schedule,
+// the lock has to be held by the caller
+func (s *intensitySchedule) resolve() error {
+	points := make([]schedulePoint, 0, len(s.entries))
+	for _, entry := range s.entries {
+		offset, err := scheduleOffset(entry.At, s.started)
+		if err != nil {
+			return err
+		}
+		points = append(points, schedulePoint{offset: offset, intensity: entry.Intensity})
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].offset < points[j].offset
+	})
+	s.points = points
+	return nil
+}
+
+// scheduleOffset parses a time that is either relative to the start of the
+// schedule (e.g. "+2h") or a wall-clock time (e.g. "18:30"), which refers to
+// the day after the start if it has already passed at that point
+func scheduleOffset(at string, started time.Time) (time.Duration, error) {
+	at = strings.TrimSpace(at)
+	if strings.HasPrefix(at, "+") {
+		offset, err := time.ParseDuration(at[1:])
+		if err != nil {
+			return 0, ErrScheduleInvalid
+		}
+		return offset, nil
+	}
+
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		clock, err = time.Parse("15:04:05", at)
+	}
+	if err != nil {
+		return 0, ErrScheduleInvalid
+	}
+	y, m, d := started.Date()
+	t := time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), 0, started.Location())
+	if t.Before(started) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.Sub(started), nil
+}
+
+// target interpolates the intensity the schedule wants to reach at the given
+// time and returns the next entry, the lock has to be held by the caller
+func (s *intensitySchedule) target(now time.Time) (int, time.Time, int) {
+	elapsed := now.Sub(s.started)
+	prev := s.anchor
+	for _, point := range s.points {
+		if point.offset <= elapsed {
+			if point.offset >= prev.offset {
+				prev = point
+			}
+			continue
+		}
+		progress := float64(elapsed-prev.offset) / float64(point.offset-prev.offset)
+		intensity := prev.intensity + int(math.Round(float64(point.intensity-prev.intensity)*progress))
+		return intensity, s.started.Add(point.offset), point.intensity
+	}
+	return prev.intensity, time.Time{}, prev.intensity
+}
+
+// suspend pauses the schedule after a manual change of the intensity
+func (s *intensitySchedule) suspend() {
+	s.lock.Lock()
+	if !s.running || s.paused {
+		s.lock.Unlock()
+		return
+	}
+	s.suspended = time.Now().Add(s.override)
+	s.lock.Unlock()
+
+	log.WithFields(log.Fields{
+		"duration": s.override,
+	}).Debug("Suspended the intensity schedule after a manual change")
+	scheduleChanged()
+}
+
+func (s *intensitySchedule) run() {
+	ticker := time.NewTicker(scheduleInterval)
+	for now := range ticker.C {
+		s.lock.Lock()
+		if !s.running || s.paused {
+			s.lock.Unlock()
+			continue
+		}
+		resumed := false
+		if !s.suspended.IsZero() {
+			if now.Before(s.suspended) {
+				s.lock.Unlock()
+				continue
+			}
+			s.suspended = time.Time{}
+			s.anchor = schedulePoint{offset: now.Sub(s.started), intensity: GetIntensity()}
+			resumed = true
+		}
+		intensity, _, _ := s.target(now)
+		s.lock.Unlock()
+
+		if resumed {
+			log.Info("Resumed the intensity schedule")
+			scheduleChanged()
+		}
+		if intensity != GetIntensity() {
+			setIntensity(intensity)
+		}
+	}
+}
+
+func scheduleChanged() {
+	EventFire(Event{
+		Origin: "audio",
+		Type:   "schedule",
+	})
+}
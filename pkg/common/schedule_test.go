@@ -0,0 +1,123 @@
+package common
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleOffset(t *testing.T) {
+	started := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		at      string
+		want    time.Duration
+		wantErr error
+	}{
+		{"+2h", 2 * time.Hour, nil},
+		{" +90m ", 90 * time.Minute, nil},
+		{"+0s", 0, nil},
+		{"18:30", 30 * time.Minute, nil},
+		{"18:00", 0, nil},
+		{"18:30:15", 30*time.Minute + 15*time.Second, nil},
+		{"02:00", 8 * time.Hour, nil}, // The next day
+		{"17:59", 24*time.Hour - time.Minute, nil},
+		{"+2 hours", 0, ErrScheduleInvalid},
+		{"25:00", 0, ErrScheduleInvalid},
+		{"soon", 0, ErrScheduleInvalid},
+		{"", 0, ErrScheduleInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.at, func(t *testing.T) {
+			got, err := scheduleOffset(tt.at, started)
+			if err != tt.wantErr {
+				t.Fatalf("scheduleOffset(%q) error = %v, want %v", tt.at, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("scheduleOffset(%q) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleTarget(t *testing.T) {
+	started := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+	s := intensitySchedule{
+		entries: []ScheduleEntry{
+			{At: "20:00", Intensity: 20},
+			{At: "+1h", Intensity: 80},
+			{At: "+3h", Intensity: 100},
+		},
+		started: started,
+		anchor:  schedulePoint{intensity: 40},
+	}
+	if err := s.resolve(); err != nil {
+		t.Fatalf("resolve() failed: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		elapsed       time.Duration
+		want          int
+		next          time.Duration
+		nextIntensity int
+	}{
+		{"start", 0, 40, time.Hour, 80},
+		{"towards the first entry", 30 * time.Minute, 60, time.Hour, 80},
+		{"on the first entry", time.Hour, 80, 2 * time.Hour, 20},
+		{"towards the wall-clock entry", 90 * time.Minute, 50, 2 * time.Hour, 20},
+		{"towards the last entry", 150 * time.Minute, 60, 3 * time.Hour, 100},
+		{"after the last entry", 4 * time.Hour, 100, -1, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, nextIntensity := s.target(started.Add(tt.elapsed))
+			if got != tt.want {
+				t.Errorf("target() intensity = %d, want %d", got, tt.want)
+			}
+			wantNext := time.Time{}
+			if tt.next >= 0 {
+				wantNext = started.Add(tt.next)
+			}
+			if !next.Equal(wantNext) || nextIntensity != tt.nextIntensity {
+				t.Errorf("target() next = %d at %v, want %d at %v", nextIntensity, next, tt.nextIntensity, wantNext)
+			}
+		})
+	}
+
+	// A manual change in between moves the anchor the schedule continues from
+	s.anchor = schedulePoint{offset: 90 * time.Minute, intensity: 0}
+	if got, _, _ := s.target(started.Add(105 * time.Minute)); got != 10 {
+		t.Errorf("target() after a manual change = %d, want %d", got, 10)
+	}
+
+	s.entries = append(s.entries, ScheduleEntry{At: "later", Intensity: 10})
+	if err := s.resolve(); err != ErrScheduleInvalid {
+		t.Errorf("resolve() with an invalid entry = %v, want %v", err, ErrScheduleInvalid)
+	}
+}
+
+func TestIntensityConcurrentAccess(t *testing.T) {
+	defer setIntensity(GetIntensity())
+
+	// The schedule sets the intensity while it is read and changed manually
+	var wg sync.WaitGroup
+	for idx := 0; idx < 4; idx++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			setIntensity(idx * 10)
+		}()
+		go func() {
+			defer wg.Done()
+			ChangeIntensity(1)
+		}()
+		go func() {
+			defer wg.Done()
+			GetSchedule()
+		}()
+	}
+	wg.Wait()
+	if got := GetIntensity(); got < 0 || got > 100 {
+		t.Errorf("GetIntensity() = %d, want a value from 0 to 100", got)
+	}
+}
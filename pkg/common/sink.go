@@ -0,0 +1,305 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sinks the master bus can be played on
+const (
+	SinkSpeaker = "speaker"
+	SinkNull    = "null"
+	SinkWAV     = "wav"
+)
+
+var ErrSinkUnknown = errors.New("audio sink could not be found")
+
+// A Sink consumes the master bus, either by playing it on a speaker or by
+// pulling it at its own clock. Sinks must stream while holding the speaker
+// lock, which all streamers of the master bus rely on
+type Sink interface {
+	Open(rate beep.SampleRate, buffersize int) error
+	Play(streamer beep.Streamer)
+	Close() error
+}
+
+var sink Sink
+
+// InitSink chooses the sink from the config, must be called before the
+// speaker is initialized.
+func InitSink(cfg *Config) error {
+	switch cfg.Audio.Sink {
+	case SinkSpeaker, "":
+		return SetSink(&speakerSink{device: cfg.Audio.Device})
+	case SinkNull:
+		return SetSink(&OfflineSink{realtime: true})
+	case SinkWAV:
+		return SetSink(&OfflineSink{path: cfg.Audio.SinkFile, realtime: true})
+	}
+	return ErrSinkUnknown
+}
+
+// SetSink replaces the sink the master bus is played on, e.g. with an offline
+// sink in tests, must be called before the speaker is initialized.
+func SetSink(s Sink) error {
+	if initialized != 0 {
+		return ErrSpeakerContextReused
+	}
+	sink = s
+	return nil
+}
+
+// GetSink returns the sink the master bus is played on.
+func GetSink() Sink {
+	return sink
+}
+
+// CloseSink stops playing the master bus, which finishes the file of a WAV
+// sink.
+func CloseSink() error {
+	if sink == nil {
+		return nil
+	}
+	return sink.Close()
+}
+
+// ResetSpeaker closes the sink and drops the master bus, so that the speaker
+// can be set up again from scratch, e.g. by the next test.
+func ResetSpeaker() error {
+	err := CloseSink()
+	speaker.Lock()
+	defer speaker.Unlock()
+	initialized = 0
+	sink = nil
+	mixer, musicMixer, soundsMixer = nil, nil, nil
+	volumeStream = nil
+	duck, eq, cross, limit = nil, nil, nil, nil
+	for _, channel := range channels {
+		channel.stream = nil
+	}
+	routing = defaultRouting()
+	output = OutputSettings{}
+	return err
+}
+
+// The speaker sink plays the master bus on a sound card
+type speakerSink struct {
+	device   string
+	rate     beep.SampleRate
+	buffer   int
+	streamer beep.Streamer
+	lock     sync.Mutex
+}
+
+func (s *speakerSink) Open(rate beep.SampleRate, buffersize int) error {
+	s.rate, s.buffer = rate, buffersize
+
+	// Fall back to the system default if the configured device is missing
+	err := s.open(s.device)
+	if err != nil && s.device != "" {
+		log.WithFields(log.Fields{
+			"device": s.device,
+			"err":    err,
+		}).Warn("Could not open the audio device, using the default one")
+		err = s.open("")
+	}
+	return err
+}
+
+func (s *speakerSink) Play(streamer beep.Streamer) {
+	s.streamer = streamer
+	speaker.Play(streamer)
+}
+
+func (s *speakerSink) Close() error {
+	speaker.Close()
+	return nil
+}
+
+// switchDevice moves the output to another device, or back to the previous
+// one if it can not be opened
+func (s *speakerSink) switchDevice(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	previous := s.getDevice()
+	err := s.open(id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"device": id,
+			"err":    err,
+		}).Error("Could not open the audio device, going back to the previous one")
+		if fallbackErr := s.open(previous); fallbackErr != nil {
+			return fallbackErr
+		}
+		return err
+	}
+	return nil
+}
+
+// open (re)initializes the speaker on a device and keeps playing the master
+// bus on it
+func (s *speakerSink) open(id string) error {
+	// The speaker has to be closed without holding its lock, as it waits for
+	// the last update to finish
+	speaker.Close()
+	err := selectDevice(id)
+	if err == nil {
+		err = speaker.Init(s.rate, s.buffer)
+	}
+	if err != nil {
+		return err
+	}
+	speaker.Lock()
+	s.device = id
+	speaker.Unlock()
+	if s.streamer != nil {
+		speaker.Play(s.streamer)
+	}
+	return nil
+}
+
+func (s *speakerSink) getDevice() string {
+	speaker.Lock()
+	defer speaker.Unlock()
+	return s.device
+}
+
+// OfflineSink pulls the master bus at a simulated clock instead of playing it,
+// and writes it to a WAV file if it has one. Unless it was set up from the
+// config, the clock only moves when it is advanced, so that the audio logic
+// can be run deterministically
+type OfflineSink struct {
+	path     string
+	realtime bool
+	rate     beep.SampleRate
+	samples  [][2]float64
+	streamer beep.Streamer
+	wav      *wavWriter
+	position int
+	done     chan struct{}
+	lock     sync.Mutex
+}
+
+// NewNullSink creates a sink that discards the master bus.
+func NewNullSink() *OfflineSink {
+	return &OfflineSink{}
+}
+
+// NewWAVSink creates a sink that writes the master bus to a WAV file.
+func NewWAVSink(path string) *OfflineSink {
+	return &OfflineSink{path: path}
+}
+
+func (s *OfflineSink) Open(rate beep.SampleRate, buffersize int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rate = rate
+	s.samples = make([][2]float64, max(1, buffersize))
+	if s.path != "" {
+		err := os.MkdirAll(filepath.Dir(s.path), 0755)
+		if err != nil {
+			return err
+		}
+		file, err := os.Create(s.path)
+		if err != nil {
+			return err
+		}
+		s.wav, err = newWAVWriter(file, rate)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	// Sinks from the config stand in for a speaker, so they keep up with the
+	// wall clock
+	if s.realtime {
+		s.done = make(chan struct{})
+		go s.run(rate.D(len(s.samples)))
+	}
+	return nil
+}
+
+func (s *OfflineSink) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := s.Advance(interval)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"file": s.path,
+					"err":  err,
+				}).Error("Could not write the audio output")
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *OfflineSink) Play(streamer beep.Streamer) {
+	speaker.Lock()
+	s.streamer = streamer
+	speaker.Unlock()
+}
+
+// Advance moves the clock of the sink forward, pulling as many samples from
+// the master bus as would have been played in that time.
+func (s *OfflineSink) Advance(d time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.samples == nil {
+		return nil
+	}
+	for remaining := s.rate.N(d); remaining > 0; {
+		chunk := s.samples[:min(remaining, len(s.samples))]
+		speaker.Lock()
+		n := 0
+		if s.streamer != nil {
+			n, _ = s.streamer.Stream(chunk)
+		}
+		speaker.Unlock()
+		for i := range chunk[n:] {
+			chunk[n+i] = [2]float64{}
+		}
+		if s.wav != nil {
+			if err := s.wav.write(chunk); err != nil {
+				return err
+			}
+		}
+		s.position += len(chunk)
+		remaining -= len(chunk)
+	}
+	return nil
+}
+
+// Elapsed returns the time the clock of the sink has moved so far.
+func (s *OfflineSink) Elapsed() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rate.D(s.position)
+}
+
+func (s *OfflineSink) Close() error {
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.wav == nil {
+		return nil
+	}
+	err := s.wav.close()
+	s.wav = nil
+	return err
+}
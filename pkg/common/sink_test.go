@@ -0,0 +1,141 @@
+package common
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+const testRate = beep.SampleRate(44100)
+
+// countingStreamer plays a constant level and counts the samples it played
+type countingStreamer struct {
+	level  float64
+	played int
+}
+
+func (c *countingStreamer) Stream(samples [][2]float64) (int, bool) {
+	for i := range samples {
+		samples[i] = [2]float64{c.level, c.level}
+	}
+	c.played += len(samples)
+	return len(samples), true
+}
+
+func (c *countingStreamer) Err() error {
+	return nil
+}
+
+// setupSink initializes the speaker on the given sink and resets it once the
+// test is done
+func setupSink(t *testing.T, s Sink) {
+	t.Helper()
+	if err := ResetSpeaker(); err != nil {
+		t.Fatalf("could not reset the speaker: %v", err)
+	}
+	if err := SetSink(s); err != nil {
+		t.Fatalf("could not set the sink: %v", err)
+	}
+	if _, err := GetSpeaker(testRate, 512, 100, ""); err != nil {
+		t.Fatalf("could not initialize the speaker: %v", err)
+	}
+	t.Cleanup(func() {
+		ResetSpeaker()
+	})
+}
+
+func TestNullSinkPlaysSound(t *testing.T) {
+	s := NewNullSink()
+	setupSink(t, s)
+
+	source := &countingStreamer{level: 0.5}
+	PlaySound("horn", beep.Take(testRate.N(300*time.Millisecond), source))
+	if err := s.Advance(time.Second); err != nil {
+		t.Fatalf("could not advance the sink: %v", err)
+	}
+
+	if got := s.Elapsed(); got != time.Second {
+		t.Errorf("Elapsed() = %v, want %v", got, time.Second)
+	}
+	if want := testRate.N(300 * time.Millisecond); source.played != want {
+		t.Errorf("played %d samples, want %d", source.played, want)
+	}
+	if duck.active != 0 {
+		t.Errorf("%d sounds still duck the music after they ended", duck.active)
+	}
+}
+
+func TestSinkCanBeSetUpAgain(t *testing.T) {
+	for run := 0; run < 2; run++ {
+		s := NewNullSink()
+		setupSink(t, s)
+		source := &countingStreamer{level: 0.5}
+		PlaySound("horn", beep.Take(100, source))
+		if err := s.Advance(10 * time.Millisecond); err != nil {
+			t.Fatalf("could not advance the sink: %v", err)
+		}
+		if source.played != 100 {
+			t.Errorf("run %d: played %d samples, want 100", run, source.played)
+		}
+	}
+}
+
+func TestWAVSinkWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "test.wav")
+	s := NewWAVSink(path)
+	setupSink(t, s)
+
+	PlaySound("horn", beep.Take(1000, &countingStreamer{level: 0.5}))
+	if err := s.Advance(500 * time.Millisecond); err != nil {
+		t.Fatalf("could not advance the sink: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("could not close the sink: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read the file: %v", err)
+	}
+	frames := testRate.N(500 * time.Millisecond)
+	if want := wavHeaderSize + frames*wavFrameSize; len(data) != want {
+		t.Fatalf("file has %d bytes, want %d", len(data), want)
+	}
+	tests := []struct {
+		name string
+		got  uint32
+		want uint32
+	}{
+		{"riff size", binary.LittleEndian.Uint32(data[4:]), uint32(len(data) - 8)},
+		{"format", uint32(binary.LittleEndian.Uint16(data[20:])), 1},
+		{"channels", uint32(binary.LittleEndian.Uint16(data[22:])), 2},
+		{"rate", binary.LittleEndian.Uint32(data[24:]), uint32(testRate)},
+		{"bits", uint32(binary.LittleEndian.Uint16(data[34:])), 16},
+		{"data size", binary.LittleEndian.Uint32(data[40:]), uint32(frames * wavFrameSize)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+	for _, chunk := range []string{"RIFF", "WAVE", "fmt ", "data"} {
+		found := false
+		for _, at := range []int{0, 8, 12, 36} {
+			found = found || string(data[at:at+4]) == chunk
+		}
+		if !found {
+			t.Errorf("header has no %q", chunk)
+		}
+	}
+
+	// The sound is audible at first and silence is written after it ended
+	first := int16(binary.LittleEndian.Uint16(data[wavHeaderSize:]))
+	last := int16(binary.LittleEndian.Uint16(data[len(data)-wavFrameSize:]))
+	if first <= 0 || last != 0 {
+		t.Errorf("first sample = %d, last sample = %d, want a positive and a silent one", first, last)
+	}
+}
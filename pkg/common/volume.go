@@ -0,0 +1,241 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/speaker"
+	log "github.com/sirupsen/logrus"
+)
+
+// Below the master volume, music and sounds each have their own volume
+// channel, and every sound has a volume relative to the sounds channel
+const (
+	ChannelMusic  = "music"
+	ChannelSounds = "sounds"
+)
+
+// Volumes are saved with a short delay, as they are usually changed in quick
+// succession while a slider is dragged
+const volumeSaveDelay = 2 * time.Second
+
+var ErrChannelNotFound = errors.New("volume channel could not be found")
+
+type volumeChannel struct {
+	level  int
+	stream *effects.Volume
+}
+
+var channels = map[string]*volumeChannel{
+	ChannelMusic:  {level: 100},
+	ChannelSounds: {level: 100},
+}
+
+// The volumes of the last run are stored in a file, so that they survive
+// restarts
+var volumes struct {
+	path   string
+	sounds map[string]int
+	timer  *time.Timer
+	lock   sync.Mutex
+}
+
+type storedVolumes struct {
+	Master   int            `json:"master"`
+	Channels map[string]int `json:"channels"`
+	Sounds   map[string]int `json:"sounds"`
+}
+
+// InitVolumes restores the volumes of the last run, or uses the configured
+// ones if there are none yet.
+func InitVolumes(cfg *Config) {
+	stored := storedVolumes{
+		Master: cfg.Audio.Volume,
+		Channels: map[string]int{
+			ChannelMusic:  cfg.Music.Volume,
+			ChannelSounds: cfg.Sounds.Volume,
+		},
+		Sounds: make(map[string]int),
+	}
+	data, err := os.ReadFile(cfg.Audio.Volumes)
+	if err == nil {
+		err = json.Unmarshal(data, &stored)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.WithFields(log.Fields{
+			"file": cfg.Audio.Volumes,
+			"err":  err,
+		}).Warn("Could not restore the volumes")
+	}
+
+	volumes.lock.Lock()
+	volumes.path = cfg.Audio.Volumes
+	volumes.sounds = stored.Sounds
+	if volumes.sounds == nil {
+		volumes.sounds = make(map[string]int)
+	}
+	volumes.lock.Unlock()
+
+	if volumeStream != nil {
+		SetVolume(stored.Master)
+	}
+	for name, level := range stored.Channels {
+		if _, ok := channels[name]; ok {
+			SetChannelVolume(name, level)
+		}
+	}
+}
+
+// newChannelStream creates the volume stream of a channel, must be called
+// before the speaker starts playing
+func newChannelStream(name string, streamer beep.Streamer) *effects.Volume {
+	channel := channels[name]
+	channel.stream = &effects.Volume{Streamer: streamer, Base: 2}
+	ApplyVolume(channel.stream, channel.level)
+	return channel.stream
+}
+
+// ApplyVolume sets the level of a volume stream in percent, 0 mutes it
+func ApplyVolume(stream *effects.Volume, volume int) {
+	stream.Silent = volume <= 0
+	if volume > 0 {
+		stream.Volume = math.Log2(float64(volume) / 100)
+	}
+}
+
+func clampVolume(volume int) int {
+	if volume > 100 {
+		return 100
+	} else if volume < 0 {
+		return 0
+	}
+	return volume
+}
+
+func SetChannelVolume(name string, volume int) error {
+	channel, ok := channels[name]
+	if !ok {
+		return ErrChannelNotFound
+	}
+	volume = clampVolume(volume)
+
+	speaker.Lock()
+	channel.level = volume
+	if channel.stream != nil {
+		ApplyVolume(channel.stream, volume)
+	}
+	speaker.Unlock()
+
+	saveVolumes()
+	EventFire(Event{
+		Origin: "audio",
+		Name:   name,
+		Type:   "volume",
+	})
+	return nil
+}
+
+func ChangeChannelVolume(name string, delta int) error {
+	volume, err := GetChannelVolume(name)
+	if err != nil {
+		return err
+	}
+	return SetChannelVolume(name, volume+delta)
+}
+
+func GetChannelVolume(name string) (int, error) {
+	channel, ok := channels[name]
+	if !ok {
+		return 0, ErrChannelNotFound
+	}
+	speaker.Lock()
+	defer speaker.Unlock()
+	return channel.level, nil
+}
+
+// GetSoundVolume returns the volume of a single sound, relative to the sounds
+// channel
+func GetSoundVolume(name string) int {
+	volumes.lock.Lock()
+	defer volumes.lock.Unlock()
+	if volume, ok := volumes.sounds[name]; ok {
+		return volume
+	}
+	return 100
+}
+
+// SetSoundVolume stores the volume of a single sound, it is applied by the
+// sound itself.
+func SetSoundVolume(name string, volume int) int {
+	volume = clampVolume(volume)
+	volumes.lock.Lock()
+	if volumes.sounds == nil {
+		volumes.sounds = make(map[string]int)
+	}
+	if volume == 100 {
+		delete(volumes.sounds, name)
+	} else {
+		volumes.sounds[name] = volume
+	}
+	volumes.lock.Unlock()
+
+	saveVolumes()
+	EventFire(Event{
+		Origin: "sounds",
+		Name:   name,
+		Type:   "volume",
+	})
+	return volume
+}
+
+// saveVolumes writes the volumes to their file after a short delay, which is
+// restarted by every change
+func saveVolumes() {
+	volumes.lock.Lock()
+	defer volumes.lock.Unlock()
+	if volumes.path == "" {
+		return
+	}
+	if volumes.timer != nil {
+		volumes.timer.Stop()
+	}
+	volumes.timer = time.AfterFunc(volumeSaveDelay, writeVolumes)
+}
+
+func writeVolumes() {
+	stored := storedVolumes{
+		Master:   GetVolume(),
+		Channels: make(map[string]int, len(channels)),
+		Sounds:   make(map[string]int),
+	}
+	for name := range channels {
+		stored.Channels[name], _ = GetChannelVolume(name)
+	}
+	volumes.lock.Lock()
+	path := volumes.path
+	for name, volume := range volumes.sounds {
+		stored.Sounds[name] = volume
+	}
+	volumes.lock.Unlock()
+
+	data, err := json.Marshal(stored)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file": path,
+			"err":  err,
+		}).Error("Could not save the volumes")
+	}
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/faiface/beep/effects"
+)
+
+func TestApplyVolume(t *testing.T) {
+	tests := []struct {
+		volume int
+		want   float64
+		silent bool
+	}{
+		{100, 0, false},
+		{50, -1, false},
+		{25, -2, false},
+		{0, 0, true},
+		{-5, 0, true},
+	}
+	for _, tt := range tests {
+		stream := &effects.Volume{Base: 2}
+		ApplyVolume(stream, tt.volume)
+		if stream.Silent != tt.silent || (!tt.silent && stream.Volume != tt.want) {
+			t.Errorf("ApplyVolume(%d) = %v, silent %v, want %v, silent %v", tt.volume, stream.Volume, stream.Silent, tt.want, tt.silent)
+		}
+	}
+}
+
+func TestClampVolume(t *testing.T) {
+	tests := map[int]int{-10: 0, 0: 0, 42: 42, 100: 100, 150: 100}
+	for volume, want := range tests {
+		if got := clampVolume(volume); got != want {
+			t.Errorf("clampVolume(%d) = %d, want %d", volume, got, want)
+		}
+	}
+}
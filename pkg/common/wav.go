@@ -0,0 +1,75 @@
+package common
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+
+	"github.com/faiface/beep"
+)
+
+// WAV files are written as 16 bit stereo PCM, like the speaker plays them
+const (
+	wavHeaderSize = 44
+	wavFrameSize  = 4
+)
+
+// The wavWriter writes samples as they come, the sizes in the header are
+// filled in when it is closed
+type wavWriter struct {
+	file   *os.File
+	frames int
+	buf    []byte
+}
+
+func newWAVWriter(file *os.File, rate beep.SampleRate) (*wavWriter, error) {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 2)
+	binary.LittleEndian.PutUint32(header[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(rate)*wavFrameSize)
+	binary.LittleEndian.PutUint16(header[32:], wavFrameSize)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	_, err := file.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	return &wavWriter{file: file}, nil
+}
+
+func (w *wavWriter) write(samples [][2]float64) error {
+	if cap(w.buf) < len(samples)*wavFrameSize {
+		w.buf = make([]byte, len(samples)*wavFrameSize)
+	}
+	buf := w.buf[:len(samples)*wavFrameSize]
+	for i := range samples {
+		for c := range samples[i] {
+			val := math.Max(-1, math.Min(1, samples[i][c]))
+			binary.LittleEndian.PutUint16(buf[i*wavFrameSize+c*2:], uint16(int16(val*(1<<15-1))))
+		}
+	}
+	_, err := w.file.Write(buf)
+	w.frames += len(samples)
+	return err
+}
+
+// close fills in the sizes of the header and closes the file
+func (w *wavWriter) close() error {
+	size := uint32(w.frames * wavFrameSize)
+	sizes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sizes, size+wavHeaderSize-8)
+	_, err := w.file.WriteAt(sizes, 4)
+	if err == nil {
+		binary.LittleEndian.PutUint32(sizes, size)
+		_, err = w.file.WriteAt(sizes, 40)
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
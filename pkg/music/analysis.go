@@ -0,0 +1,291 @@
+package music
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dulli/deichwave/pkg/common"
+	"github.com/faiface/beep"
+	log "github.com/sirupsen/logrus"
+)
+
+// The tempo is searched within this range and biased towards the center, to
+// avoid picking half or double the actual tempo
+const tempoMin = 60.0     // [BPM]
+const tempoMax = 180.0    // [BPM]
+const tempoCenter = 120.0 // [BPM]
+
+// Songs with unknown energy are treated as if they were this far off
+const energyUnknownDistance = 50.0
+
+var ErrTempoUnknown = errors.New("tempo could not be estimated")
+
+// The analysis index stores the estimated tempo and energy of all songs, so
+// that each of them only has to be analyzed once. The energy is ranked across
+// all songs, so that it can be compared to the intensity
+type analysisIndex struct {
+	path    string
+	entries map[string]analysisEntry
+	ranks   map[string]float64
+	lock    sync.Mutex
+}
+
+type analysisEntry struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	BPM      float64   `json:"bpm"`
+	Onsets   float64   `json:"onsets"`
+}
+
+// newAnalysisIndex loads the index stored at the given path, if there is one
+func newAnalysisIndex(path string) *analysisIndex {
+	a := &analysisIndex{path: path, entries: make(map[string]analysisEntry)}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &a.entries)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WithFields(log.Fields{
+				"file": path,
+				"err":  err,
+			}).Warn("Could not load the song analysis index")
+			a.entries = make(map[string]analysisEntry)
+		}
+	}
+	a.rank()
+	return a
+}
+
+// get returns the tempo and energy of a song, if it has been analyzed
+func (a *analysisIndex) get(path string) (float64, float64, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	entry, ok := a.entries[path]
+	if !ok {
+		return 0, 0, false
+	}
+	return entry.BPM, a.ranks[path], true
+}
+
+// analyze estimates the tempo of a song, unless it has been analyzed before
+// and did not change since, and returns whether it did. The energy is only
+// updated by the next rank
+func (a *analysisIndex) analyze(path string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	a.lock.Lock()
+	entry, ok := a.entries[path]
+	a.lock.Unlock()
+	if ok && entry.Size == stat.Size() && entry.Modified.Equal(stat.ModTime()) {
+		return false, nil
+	}
+
+	streamer, format, err := decode(path)
+	if err != nil {
+		return false, err
+	}
+	defer streamer.Close()
+	bpm, onsets, err := measureTempo(streamer, format.SampleRate)
+	if err != nil {
+		return false, err
+	}
+	log.WithFields(log.Fields{
+		"file":   path,
+		"bpm":    bpm,
+		"onsets": onsets,
+	}).Debug("Analyzed the tempo of a song")
+
+	a.lock.Lock()
+	a.entries[path] = analysisEntry{Size: stat.Size(), Modified: stat.ModTime(), BPM: bpm, Onsets: onsets}
+	a.lock.Unlock()
+	return true, nil
+}
+
+// rank calculates the energy of every song as its percentile among all songs,
+// based on how fast and how punchy it is
+func (a *analysisIndex) rank() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	paths := make([]string, 0, len(a.entries))
+	for path := range a.entries {
+		paths = append(paths, path)
+	}
+	raw := func(path string) float64 {
+		return a.entries[path].Onsets * a.entries[path].BPM / tempoCenter
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return raw(paths[i]) < raw(paths[j])
+	})
+	a.ranks = make(map[string]float64, len(paths))
+	for idx, path := range paths {
+		if len(paths) > 1 {
+			a.ranks[path] = 100 * float64(idx) / float64(len(paths)-1)
+		} else {
+			a.ranks[path] = 50
+		}
+	}
+}
+
+func (a *analysisIndex) save() {
+	if a.path == "" {
+		return
+	}
+
+	a.lock.Lock()
+	data, err := json.Marshal(a.entries)
+	a.lock.Unlock()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(a.path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(a.path, data, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file": a.path,
+			"err":  err,
+		}).Error("Could not save the song analysis index")
+	}
+}
+
+// measureTempo estimates the tempo of a stream from the periodicity of its
+// onsets, it also returns the average strength of the onsets per second
+func measureTempo(streamer beep.Streamer, rate beep.SampleRate) (float64, float64, error) {
+	// The energy is gathered in frames of 512 samples, the onsets are the
+	// increases of the logarithmic energy between two frames
+	const hop = 512
+	onsets := make([]float64, 0)
+	prev, sum, count := 0.0, 0.0, 0
+	samples := make([][2]float64, 512)
+	for {
+		n, ok := streamer.Stream(samples)
+		for _, sample := range samples[:n] {
+			mono := (sample[0] + sample[1]) / 2
+			sum += mono * mono
+			count++
+			if count == hop {
+				energy := math.Log10(sum/hop + 1e-10)
+				onsets = append(onsets, math.Max(0, energy-prev))
+				prev, sum, count = energy, 0, 0
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// The tempo is the lag at which the onsets correlate best
+	fps := float64(rate) / hop
+	minLag := int(math.Floor(fps * 60 / tempoMax))
+	maxLag := int(math.Ceil(fps * 60 / tempoMin))
+	if len(onsets) < 2*maxLag {
+		return 0, 0, ErrTempoUnknown
+	}
+	correlation := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		sum := 0.0
+		for i := 0; i+lag < len(onsets); i++ {
+			sum += onsets[i] * onsets[i+lag]
+		}
+		correlation[lag] = sum / float64(len(onsets)-lag)
+	}
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		bias := math.Log2(60 * fps / float64(lag) / tempoCenter)
+		score := correlation[lag] * math.Exp(-bias*bias/2)
+		if score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return 0, 0, ErrTempoUnknown
+	}
+
+	// Interpolate between the neighbouring lags for a finer resolution
+	lag := float64(best)
+	y0, y1, y2 := correlation[best-1], correlation[best], correlation[best+1]
+	if d := y0 - 2*y1 + y2; d != 0 {
+		lag += math.Max(-0.5, math.Min(0.5, (y0-y2)/(2*d)))
+	}
+
+	strength := 0.0
+	for _, onset := range onsets {
+		strength += onset
+	}
+	return 60 * fps / lag, strength / (float64(len(onsets)) / fps), nil
+}
+
+// analyzer analyzes all songs that are not part of the index yet, whenever
+// the playlists were (re)loaded
+func (p *musicPlayer) analyzer() {
+	for range p.analyzeRequest {
+		p.listLock.RLock()
+		paths := make([]string, 0)
+		for _, key := range p.keys {
+			for _, s := range p.list[key].songs() {
+				paths = append(paths, s.getPath())
+			}
+		}
+		p.listLock.RUnlock()
+
+		analyzed := 0
+		for _, path := range paths {
+			ok, err := p.analysis.analyze(path)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"file": path,
+					"err":  err,
+				}).Debug("Could not analyze a song")
+				continue
+			}
+			if !ok {
+				continue
+			}
+			analyzed++
+			if analyzed%50 == 0 {
+				p.analysis.save()
+			}
+		}
+		if analyzed == 0 {
+			continue
+		}
+
+		// The energy is a percentile among all songs, so they are ranked once
+		// per pass instead of after every song
+		p.analysis.rank()
+		p.analysis.save()
+		log.WithFields(log.Fields{
+			"count": analyzed,
+			"songs": len(paths),
+		}).Info("Analyzed the tempo and energy of new songs")
+	}
+}
+
+// requestAnalysis makes the analyzer look for songs that were not analyzed yet
+func (p *musicPlayer) requestAnalysis() {
+	select {
+	case p.analyzeRequest <- true:
+	default:
+	}
+}
+
+// energyDistance compares the energy of a song to the current intensity
+func (p *musicPlayer) energyDistance(s Song) float64 {
+	if _, energy, ok := p.analysis.get(s.getPath()); ok {
+		return math.Abs(energy - float64(common.GetIntensity()))
+	}
+	return energyUnknownDistance
+}
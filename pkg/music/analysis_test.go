@@ -0,0 +1,92 @@
+package music
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+)
+
+// writeTestBeat writes short bursts of noise at the given tempo as a WAV file
+func writeTestBeat(t *testing.T, path string, length time.Duration, bpm float64) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("could not create the song: %v", err)
+	}
+	defer file.Close()
+
+	beat := int(float64(testRate) * 60 / bpm)
+	pos := 0
+	pulses := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			v := 0.0
+			if offset := pos % beat; offset < testRate.N(20*time.Millisecond) {
+				v = 0.8 * math.Sin(float64(pos)*1.3) * math.Exp(-float64(offset)/500)
+			}
+			samples[i] = [2]float64{v, v}
+			pos++
+		}
+		return len(samples), true
+	})
+	format := beep.Format{SampleRate: testRate, NumChannels: 2, Precision: 2}
+	if err := wav.Encode(file, beep.Take(testRate.N(length), pulses), format); err != nil {
+		t.Fatalf("could not encode the song: %v", err)
+	}
+}
+
+func TestAnalysisIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wav")
+	writeTestBeat(t, path, 8*time.Second, 120)
+	a := newAnalysisIndex(filepath.Join(dir, "analysis.json"))
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"new song", true},
+		{"unchanged song", false},
+	}
+	for _, tt := range tests {
+		ok, err := a.analyze(path)
+		if err != nil {
+			t.Fatalf("%s: analyze() failed: %v", tt.name, err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: analyze() = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+	if bpm, _, ok := a.get(path); !ok || math.Abs(bpm-120) > 5 {
+		t.Errorf("get() = %v BPM, %v, want about 120 BPM", bpm, ok)
+	}
+	if _, err := a.analyze(filepath.Join(dir, "missing.wav")); err == nil {
+		t.Errorf("analyze() of a missing song succeeded")
+	}
+}
+
+func TestAnalysisRank(t *testing.T) {
+	a := newAnalysisIndex("")
+	a.entries = map[string]analysisEntry{
+		"slow":   {BPM: 80, Onsets: 1},
+		"medium": {BPM: 120, Onsets: 1},
+		"fast":   {BPM: 160, Onsets: 2},
+	}
+	a.rank()
+	want := map[string]float64{"slow": 0, "medium": 50, "fast": 100}
+	for path, energy := range want {
+		if _, got, ok := a.get(path); !ok || got != energy {
+			t.Errorf("energy of %q = %v, want %v", path, got, energy)
+		}
+	}
+
+	a.entries = map[string]analysisEntry{"only": {BPM: 120, Onsets: 1}}
+	a.rank()
+	if _, got, _ := a.get("only"); got != 50 {
+		t.Errorf("energy of a single song = %v, want 50", got)
+	}
+}
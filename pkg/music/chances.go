@@ -0,0 +1,234 @@
+package music
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/dulli/deichwave/pkg/common"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrChancesUnknownPlaylist = errors.New("chances are defined for a playlist that could not be found")
+var ErrChancesMissingPlaylist = errors.New("chances are missing for a playlist")
+var ErrChanceCurveInvalid = errors.New("chance curve needs [intensity, chance] pairs with increasing intensities from 0 to 100")
+
+// PlaylistChances lists the chance of a playlist for every intensity from 0
+// to 100 and its resulting share of all chances
+type PlaylistChances struct {
+	Playlist      string
+	Chances       []int
+	Probabilities []float64
+}
+
+// A chance curve maps the intensity to the chance of a playlist to be picked,
+// the chance is interpolated linearly between the breakpoints
+type chanceCurve []breakpoint
+
+type breakpoint struct {
+	intensity int
+	chance    int
+}
+
+// newChanceCurve creates a curve from [intensity, chance] pairs, which have to
+// be sorted by intensity
+func newChanceCurve(points [][]int) (chanceCurve, error) {
+	curve := make(chanceCurve, 0, len(points))
+	for idx, point := range points {
+		if len(point) != 2 || point[0] < 0 || point[0] > 100 {
+			return nil, ErrChanceCurveInvalid
+		}
+		if idx > 0 && point[0] <= curve[idx-1].intensity {
+			return nil, ErrChanceCurveInvalid
+		}
+		curve = append(curve, breakpoint{intensity: point[0], chance: point[1]})
+	}
+	if len(curve) == 0 {
+		return nil, ErrChanceCurveInvalid
+	}
+	return curve, nil
+}
+
+// linearCurve creates a curve from the chances at the lowest and the highest
+// intensity
+func linearCurve(start int, end int) chanceCurve {
+	return chanceCurve{{intensity: 0, chance: start}, {intensity: 100, chance: end}}
+}
+
+// at returns the chance for the given intensity
+func (c chanceCurve) at(intensity int) int {
+	if intensity <= c[0].intensity {
+		return c[0].chance
+	}
+	for idx := 1; idx < len(c); idx++ {
+		if intensity <= c[idx].intensity {
+			x0, y0 := float64(c[idx-1].intensity), float64(c[idx-1].chance)
+			x1, y1 := float64(c[idx].intensity), float64(c[idx].chance)
+			return int(y0 + math.Round((float64(intensity)-x0)*(y1-y0)/(x1-x0)))
+		}
+	}
+	return c[len(c)-1].chance
+}
+
+// configureChances takes the chances from the config, named playlist tables
+// take precedence over the positional arrays
+func (p *musicPlayer) configureChances(cfg *common.Config) {
+	weights := make(map[string]chanceCurve, len(cfg.Music.Playlists))
+	modes := make(map[string]string)
+	for name, pl := range cfg.Music.Playlists {
+		switch pl.Mode {
+		case "":
+		case ModeShuffle, ModeOrdered, ModeSingle:
+			modes[name] = pl.Mode
+		default:
+			log.WithFields(log.Fields{
+				"list": name,
+				"mode": pl.Mode,
+				"err":  ErrPlaylistModeInvalid,
+			}).Error("Ignored the mode of a playlist")
+		}
+
+		// Tables that only set the mode do not define any chances
+		if pl.Start == nil && pl.End == nil && len(pl.Curve) == 0 {
+			continue
+		}
+		start, end := 0, 0
+		if pl.Start != nil {
+			start = *pl.Start
+		}
+		if pl.End != nil {
+			end = *pl.End
+		}
+		weights[name] = linearCurve(start, end)
+		if len(pl.Curve) == 0 {
+			continue
+		}
+		curve, err := newChanceCurve(pl.Curve)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"list":  name,
+				"curve": pl.Curve,
+				"err":   err,
+			}).Error("Ignored the chance curve of a playlist")
+			continue
+		}
+		weights[name] = curve
+	}
+
+	p.listLock.Lock()
+	p.weights = weights
+	p.modes = modes
+	p.chancesMin = cfg.Music.StartRNG
+	p.chancesMax = cfg.Music.EndRNG
+	p.listLock.Unlock()
+}
+
+// chanceCurve returns the configured chances of a playlist, the list lock has
+// to be held by the caller
+func (p *musicPlayer) chanceCurve(index int, name string) (chanceCurve, bool) {
+	if len(p.weights) > 0 {
+		c, ok := p.weights[name]
+		return c, ok
+	}
+	if index < len(p.chancesMin) && index < len(p.chancesMax) {
+		return linearCurve(p.chancesMin[index], p.chancesMax[index]), true
+	}
+	return nil, false
+}
+
+// chancesAt calculates the chance of every playlist for an intensity, the
+// list lock has to be held by the caller
+func (p *musicPlayer) chancesAt(intensity int) []int {
+	chances := make([]int, len(p.keys))
+	for i, key := range p.keys {
+		if c, ok := p.chanceCurve(i, key); ok {
+			chances[i] = c.at(intensity)
+		}
+	}
+	return chances
+}
+
+func (p *musicPlayer) GetChance(name string) (int, error) {
+	p.listLock.RLock()
+	defer p.listLock.RUnlock()
+	chances := p.chancesAt(common.GetIntensity())
+	for i, v := range p.keys {
+		if v == name {
+			return chances[i], nil
+		}
+	}
+	return -1, ErrPlaylistNotFound
+}
+
+// CheckChances validates the configured chances against the loaded playlists
+// and logs every playlist that is unknown or has no chances.
+func (p *musicPlayer) CheckChances() error {
+	p.listLock.RLock()
+	defer p.listLock.RUnlock()
+
+	if len(p.weights) == 0 {
+		if len(p.chancesMin) != len(p.keys) || len(p.chancesMax) != len(p.keys) {
+			log.WithFields(log.Fields{
+				"lists":    p.keys,
+				"startrng": p.chancesMin,
+				"endrng":   p.chancesMax,
+			}).Warn("The number of chances does not match the number of playlists")
+		}
+		return nil
+	}
+
+	var err error
+	names := make([]string, 0, len(p.weights))
+	for name := range p.weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := p.list[name]; !ok {
+			log.WithFields(log.Fields{
+				"list": name,
+			}).Error("Chances are defined for an unknown playlist")
+			err = ErrChancesUnknownPlaylist
+		}
+	}
+	for _, name := range p.keys {
+		if _, ok := p.weights[name]; !ok {
+			log.WithFields(log.Fields{
+				"list": name,
+			}).Error("Chances are missing for a playlist, it will never be picked")
+			if err == nil {
+				err = ErrChancesMissingPlaylist
+			}
+		}
+	}
+	return err
+}
+
+// ChanceTable calculates the chances of all playlists for every intensity.
+func (p *musicPlayer) ChanceTable() []PlaylistChances {
+	p.listLock.RLock()
+	defer p.listLock.RUnlock()
+
+	table := make([]PlaylistChances, len(p.keys))
+	for i, key := range p.keys {
+		table[i] = PlaylistChances{
+			Playlist:      key,
+			Chances:       make([]int, 101),
+			Probabilities: make([]float64, 101),
+		}
+	}
+	for intensity := 0; intensity <= 100; intensity++ {
+		chances := p.chancesAt(intensity)
+		total := 0
+		for _, chance := range chances {
+			total += chance
+		}
+		for i, chance := range chances {
+			table[i].Chances[intensity] = chance
+			if total > 0 {
+				table[i].Probabilities[intensity] = float64(chance) / float64(total)
+			}
+		}
+	}
+	return table
+}
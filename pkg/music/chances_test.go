@@ -0,0 +1,91 @@
+package music
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChanceCurveAt(t *testing.T) {
+	curve, err := newChanceCurve([][]int{{20, 10}, {50, 100}, {80, 40}})
+	if err != nil {
+		t.Fatalf("newChanceCurve() failed: %v", err)
+	}
+	tests := []struct {
+		name      string
+		curve     chanceCurve
+		intensity int
+		want      int
+	}{
+		{"before the first breakpoint", curve, 0, 10},
+		{"on the first breakpoint", curve, 20, 10},
+		{"rising", curve, 35, 55},
+		{"on a breakpoint", curve, 50, 100},
+		{"falling", curve, 65, 70},
+		{"rounded", curve, 51, 98},
+		{"after the last breakpoint", curve, 100, 40},
+		{"single breakpoint", chanceCurve{{intensity: 50, chance: 7}}, 90, 7},
+		{"linear start", linearCurve(95, 5), 0, 95},
+		{"linear middle", linearCurve(95, 5), 50, 50},
+		{"linear end", linearCurve(95, 5), 100, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.curve.at(tt.intensity); got != tt.want {
+				t.Errorf("at(%d) = %d, want %d", tt.intensity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewChanceCurveInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		points [][]int
+	}{
+		{"no points", nil},
+		{"missing chance", [][]int{{0}}},
+		{"too many values", [][]int{{0, 1, 2}}},
+		{"negative intensity", [][]int{{-1, 10}}},
+		{"intensity above 100", [][]int{{101, 10}}},
+		{"unsorted", [][]int{{50, 10}, {20, 10}}},
+		{"duplicate intensity", [][]int{{50, 10}, {50, 20}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newChanceCurve(tt.points); err != ErrChanceCurveInvalid {
+				t.Errorf("newChanceCurve(%v) = %v, want %v", tt.points, err, ErrChanceCurveInvalid)
+			}
+		})
+	}
+}
+
+func TestChanceTable(t *testing.T) {
+	root := t.TempDir()
+	for _, list := range []string{"A", "B"} {
+		writeTestSong(t, filepath.Join(root, list, "song.wav"), 10*time.Millisecond)
+	}
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+
+	// The default chances fall from 95 to 30 and rise from 5 to 70
+	table := p.ChanceTable()
+	want := map[string][2]int{"A": {95, 30}, "B": {5, 70}}
+	if len(table) != len(want) {
+		t.Fatalf("ChanceTable() has %d playlists, want %d", len(table), len(want))
+	}
+	for _, row := range table {
+		if got := [2]int{row.Chances[0], row.Chances[100]}; got != want[row.Playlist] {
+			t.Errorf("chances of %q = %v, want %v", row.Playlist, got, want[row.Playlist])
+		}
+	}
+	for intensity := 0; intensity <= 100; intensity++ {
+		total := table[0].Probabilities[intensity] + table[1].Probabilities[intensity]
+		if math.Abs(total-1) > 1e-9 {
+			t.Errorf("probabilities at %d add up to %v, want 1", intensity, total)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package music
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
+)
+
+// Covers are only ever scaled down, up to the given maximum size, and only a
+// limited amount of them is kept in memory
+const coverSizeMax = 1024  // [px]
+const coverCacheSize = 128 // Number of songs whose covers are cached
+const coverScaledMax = 4   // Number of scaled versions cached per cover
+
+var ErrCoverNotFound = errors.New("song has no cover")
+
+// Songs without embedded art use an image file in the same folder instead,
+// the names are matched case insensitive and in the given order
+var coverFiles = []string{"cover", "folder", "front", "album"}
+var coverExts = []string{".jpg", ".jpeg", ".png"}
+
+// A cover is an encoded image together with its MIME type and an ETag that
+// changes whenever the image does
+type Cover struct {
+	Data []byte
+	Mime string
+	ETag string
+}
+
+// The cover cache stores the cover of each song until the song or the image
+// file it was taken from changes, so that the tags are not parsed again on
+// every request
+type coverCache struct {
+	entries map[string]*coverEntry
+	lock    sync.Mutex
+}
+
+type coverEntry struct {
+	size           int64
+	modified       time.Time
+	source         string // Path of the image file, if it is not embedded
+	sourceModified time.Time
+	cover          *Cover // nil if the song has no cover at all
+	scaled         map[int]*Cover
+}
+
+func newCoverCache() *coverCache {
+	return &coverCache{entries: make(map[string]*coverEntry)}
+}
+
+// get returns the cover of a song, scaled down to fit into a square of the
+// given size unless it is 0
+func (c *coverCache) get(path string, pic *SongPicture, size int) (Cover, error) {
+	entry, err := c.lookup(path, pic)
+	if err != nil {
+		return Cover{}, err
+	}
+	if entry.cover == nil {
+		return Cover{}, ErrCoverNotFound
+	}
+	if size <= 0 {
+		return *entry.cover, nil
+	}
+	if size > coverSizeMax {
+		size = coverSizeMax
+	}
+
+	c.lock.Lock()
+	scaled, ok := entry.scaled[size]
+	c.lock.Unlock()
+	if ok {
+		return *scaled, nil
+	}
+
+	scaled, err = scaleCover(entry.cover, size)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Warn("Could not scale a cover")
+		return *entry.cover, nil
+	}
+	c.lock.Lock()
+	if len(entry.scaled) < coverScaledMax {
+		entry.scaled[size] = scaled
+	}
+	c.lock.Unlock()
+	return *scaled, nil
+}
+
+// lookup returns the cached cover entry of a song, or creates it from the
+// given picture, which is read from the tags of the song if it is nil
+func (c *coverCache) lookup(path string, pic *SongPicture) (*coverEntry, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	entry, ok := c.entries[path]
+	c.lock.Unlock()
+	if ok && entry.valid(stat) {
+		return entry, nil
+	}
+
+	if pic == nil {
+		sI, err := readTags(path)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path": path,
+				"err":  err,
+			}).Warn("Couldnt retrieve media tags")
+		}
+		pic = &sI.Picture
+	}
+
+	entry = &coverEntry{
+		size:     stat.Size(),
+		modified: stat.ModTime(),
+		scaled:   make(map[int]*Cover),
+	}
+	if len(pic.Data) > 0 {
+		entry.cover = newCover(pic.Data, pic.Mime)
+	} else if source, ok := findCoverFile(filepath.Dir(path)); ok {
+		data, err := os.ReadFile(source)
+		if err == nil {
+			entry.source = source
+			if sourceStat, err := os.Stat(source); err == nil {
+				entry.sourceModified = sourceStat.ModTime()
+			}
+			entry.cover = newCover(data, "")
+		}
+	}
+
+	c.lock.Lock()
+	if _, ok := c.entries[path]; !ok && len(c.entries) >= coverCacheSize {
+		for key := range c.entries {
+			delete(c.entries, key)
+			break
+		}
+	}
+	c.entries[path] = entry
+	c.lock.Unlock()
+	return entry, nil
+}
+
+// clear forgets all cached covers, e.g. to pick up new cover files
+func (c *coverCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[string]*coverEntry)
+}
+
+// valid checks if neither the song nor the image file have changed
+func (e *coverEntry) valid(stat os.FileInfo) bool {
+	if e.size != stat.Size() || !e.modified.Equal(stat.ModTime()) {
+		return false
+	}
+	if e.source == "" {
+		return true
+	}
+	sourceStat, err := os.Stat(e.source)
+	return err == nil && e.sourceModified.Equal(sourceStat.ModTime())
+}
+
+// findCoverFile looks for an image file to use as the cover of the songs in
+// the given folder
+func findCoverFile(dir string) (string, bool) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	found := make(map[string]string)
+	for _, file := range files {
+		if !file.IsDir() {
+			found[strings.ToLower(file.Name())] = file.Name()
+		}
+	}
+	for _, name := range coverFiles {
+		for _, ext := range coverExts {
+			if file, ok := found[name+ext]; ok {
+				return filepath.Join(dir, file), true
+			}
+		}
+	}
+	return "", false
+}
+
+// newCover detects the MIME type of an image, as the one stored in the tags
+// is often missing or wrong
+func newCover(data []byte, mime string) *Cover {
+	if detected := http.DetectContentType(data); strings.HasPrefix(detected, "image/") || mime == "" {
+		mime = detected
+	}
+	sum := sha1.Sum(data)
+	return &Cover{
+		Data: data,
+		Mime: mime,
+		ETag: fmt.Sprintf("%q", fmt.Sprintf("%x", sum[:8])),
+	}
+}
+
+// scaleCover scales a cover down to fit into a square of the given size, PNG
+// images stay PNG images while everything else is encoded as a JPEG
+func scaleCover(cover *Cover, size int) (*Cover, error) {
+	img, format, err := image.Decode(bytes.NewReader(cover.Data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return cover, nil
+	}
+	if w > h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "png" || format == "gif" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newCover(buf.Bytes(), ""), nil
+}
+
+// Cover returns the cover of a song, scaled down to fit into a square of the
+// given size unless it is 0
+func (p *musicPlayer) Cover(playlist string, name string, size int) (Cover, error) {
+	pl, err := p.GetPlaylist(playlist)
+	if err != nil {
+		return Cover{}, err
+	}
+	s, err := pl.GetSong(name)
+	if err != nil {
+		return Cover{}, err
+	}
+	return p.covers.get(s.getPath(), nil, size)
+}
+
+// PlayingCover returns the cover of the current song, without reading its
+// tags again
+func (p *musicPlayer) PlayingCover(size int) (Cover, error) {
+	np := p.NowPlaying()
+	if np.path == "" {
+		return Cover{}, ErrNothingPlaying
+	}
+	return p.covers.get(np.path, &np.Picture, size)
+}
@@ -0,0 +1,174 @@
+package music
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// encodeTestImage encodes a plain image of the given size as a PNG or JPEG
+func encodeTestImage(t *testing.T, format string, w int, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("could not encode the image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewCover(t *testing.T) {
+	data := encodeTestImage(t, "png", 2, 2)
+	tests := []struct {
+		name string
+		data []byte
+		mime string
+		want string
+	}{
+		{"detected", data, "", "image/png"},
+		{"wrong tag", data, "image/jpeg", "image/png"},
+		{"unknown data", []byte("not an image"), "image/jpeg", "image/jpeg"},
+		{"unknown data without tag", []byte("not an image"), "", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newCover(tt.data, tt.mime).Mime; got != tt.want {
+				t.Errorf("newCover() mime = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if a, b := newCover(data, ""), newCover(append([]byte{}, data...), ""); a.ETag != b.ETag {
+		t.Errorf("the ETags of equal covers differ: %s and %s", a.ETag, b.ETag)
+	}
+	if a, b := newCover(data, ""), newCover(encodeTestImage(t, "png", 3, 3), ""); a.ETag == b.ETag {
+		t.Errorf("the ETags of different covers are both %s", a.ETag)
+	}
+}
+
+func TestScaleCover(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		w, h   int
+		size   int
+		wantW  int
+		wantH  int
+		mime   string
+	}{
+		{"wide png", "png", 200, 100, 50, 50, 25, "image/png"},
+		{"tall jpeg", "jpeg", 100, 200, 50, 25, 50, "image/jpeg"},
+		{"thin line", "png", 400, 1, 100, 100, 1, "image/png"},
+		{"already small", "png", 40, 30, 50, 40, 30, "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cover := newCover(encodeTestImage(t, tt.format, tt.w, tt.h), "")
+			scaled, err := scaleCover(cover, tt.size)
+			if err != nil {
+				t.Fatalf("scaleCover() failed: %v", err)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(scaled.Data))
+			if err != nil {
+				t.Fatalf("could not decode the scaled cover: %v", err)
+			}
+			if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("scaleCover() size = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+			}
+			if scaled.Mime != tt.mime {
+				t.Errorf("scaleCover() mime = %q, want %q", scaled.Mime, tt.mime)
+			}
+		})
+	}
+
+	if _, err := scaleCover(newCover([]byte("not an image"), ""), 50); err == nil {
+		t.Errorf("scaleCover() of invalid data succeeded")
+	}
+}
+
+func TestFindCoverFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"no image", []string{"song.wav", "notes.txt"}, ""},
+		{"case insensitive", []string{"song.wav", "Folder.JPG"}, "Folder.JPG"},
+		{"preferred name", []string{"album.jpg", "front.png", "cover.png"}, "cover.png"},
+		{"preferred extension", []string{"folder.png", "folder.jpeg"}, "folder.jpeg"},
+		{"unknown name", []string{"back.jpg"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+					t.Fatalf("could not write the file: %v", err)
+				}
+			}
+			got, ok := findCoverFile(dir)
+			if ok != (tt.want != "") || (ok && got != filepath.Join(dir, tt.want)) {
+				t.Errorf("findCoverFile() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayerCover(t *testing.T) {
+	root := t.TempDir()
+	writeTestSong(t, filepath.Join(root, "Party", "a.wav"), 10*time.Millisecond)
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	if _, err := p.Cover("Party", "a", 0); err != ErrCoverNotFound {
+		t.Errorf("Cover() without an image = %v, want %v", err, ErrCoverNotFound)
+	}
+
+	// New cover files are picked up by a rescan, changes to them right away
+	path := filepath.Join(root, "Party", "cover.png")
+	if err := os.WriteFile(path, encodeTestImage(t, "png", 64, 32), 0644); err != nil {
+		t.Fatalf("could not write the cover: %v", err)
+	}
+	if err := p.Rescan(); err != nil {
+		t.Fatalf("Rescan() failed: %v", err)
+	}
+	cover, err := p.Cover("Party", "a", 16)
+	if err != nil {
+		t.Fatalf("Cover() failed: %v", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(cover.Data))
+	if err != nil || cfg.Width != 16 || cfg.Height != 8 {
+		t.Errorf("Cover() size = %dx%d (%v), want 16x8", cfg.Width, cfg.Height, err)
+	}
+
+	modified := time.Now().Add(time.Minute)
+	if err := os.WriteFile(path, encodeTestImage(t, "png", 8, 8), 0644); err != nil {
+		t.Fatalf("could not write the cover: %v", err)
+	}
+	os.Chtimes(path, modified, modified)
+	updated, err := p.Cover("Party", "a", 0)
+	if err != nil {
+		t.Fatalf("Cover() failed: %v", err)
+	}
+	if updated.ETag == cover.ETag {
+		t.Errorf("Cover() did not pick up the changed image file")
+	}
+}
@@ -0,0 +1,155 @@
+package music
+
+import (
+	"github.com/faiface/beep"
+)
+
+// fader applies a linear gain ramp to a streamer, it is used to crossfade
+// between songs and to avoid clicks when a song is paused, resumed, stopped or
+// skipped. Once faded out completely, the streamer is either paused or ended
+type fader struct {
+	Streamer  beep.Streamer
+	gain      float64
+	step      float64
+	remaining int
+	stop      bool // End the stream after fading out
+	pause     bool // Pause the stream after fading out
+	paused    bool
+	done      bool
+}
+
+// newFader returns a fader that ramps its streamer up from silence over the
+// given number of samples
+func newFader(streamer beep.Streamer, samples int) *fader {
+	f := &fader{Streamer: streamer, gain: 1}
+	if samples > 0 {
+		f.gain = 0
+		f.step = 1 / float64(samples)
+		f.remaining = samples
+	}
+	return f
+}
+
+// fadeOut ramps the streamer down to silence over the given number of
+// samples, afterwards the streamer is drained. Must be called while holding
+// the speaker lock.
+func (f *fader) fadeOut(samples int) {
+	f.stop = true
+	f.pause = false
+	if samples <= 0 || f.paused {
+		f.paused = false
+		f.gain = 0
+		f.remaining = 0
+		return
+	}
+	f.ramp(0, samples)
+}
+
+// fadePause ramps the streamer down to silence over the given number of
+// samples and pauses it afterwards. Must be called while holding the speaker
+// lock.
+func (f *fader) fadePause(samples int) {
+	if f.stop {
+		return
+	}
+	f.pause = true
+	if samples <= 0 || f.paused {
+		f.paused = true
+		f.gain = 0
+		f.remaining = 0
+		return
+	}
+	f.ramp(0, samples)
+}
+
+// fadeResume continues a paused streamer and ramps it back up over the given
+// number of samples. Must be called while holding the speaker lock.
+func (f *fader) fadeResume(samples int) {
+	if f.stop || !f.pause {
+		return
+	}
+	f.pause = false
+	f.paused = false
+	if samples <= 0 {
+		f.gain = 1
+		f.remaining = 0
+		return
+	}
+	f.ramp(1, samples)
+}
+
+// isPaused checks if the streamer is paused or about to be. Must be called
+// while holding the speaker lock.
+func (f *fader) isPaused() bool {
+	return f.pause
+}
+
+func (f *fader) ramp(target float64, samples int) {
+	f.step = (target - f.gain) / float64(samples)
+	f.remaining = samples
+}
+
+func (f *fader) Stream(samples [][2]float64) (n int, ok bool) {
+	if f.done {
+		return 0, false
+	}
+	if f.paused {
+		for i := range samples {
+			samples[i] = [2]float64{}
+		}
+		return len(samples), true
+	}
+	n, ok = f.Streamer.Stream(samples)
+	for i := range samples[:n] {
+		if f.remaining > 0 {
+			f.gain += f.step
+			f.remaining--
+			if f.remaining == 0 && (f.stop || f.pause) {
+				f.gain = 0
+			} else if f.remaining == 0 {
+				f.gain = 1
+			}
+		}
+		if (f.stop || f.pause) && f.remaining == 0 {
+			// Silence everything after the ramp and end or pause the stream
+			for j := i; j < n; j++ {
+				samples[j] = [2]float64{}
+			}
+			if f.stop {
+				f.done = true
+			} else {
+				f.paused = true
+			}
+			break
+		}
+		samples[i][0] *= f.gain
+		samples[i][1] *= f.gain
+	}
+	return n, ok
+}
+
+func (f *fader) Err() error {
+	return f.Streamer.Err()
+}
+
+// cue calls a function once, as soon as the wrapped streamer gets within the
+// given number of samples of its end
+type cue struct {
+	Streamer beep.StreamSeeker
+	at       int
+	fn       func()
+	fired    bool
+}
+
+func (c *cue) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = c.Streamer.Stream(samples)
+	if !c.fired && c.Streamer.Len()-c.Streamer.Position() <= c.at {
+		c.fired = true
+		c.fn()
+	}
+	return n, ok
+}
+
+func (c *cue) Err() error {
+	return c.Streamer.Err()
+}
@@ -0,0 +1,169 @@
+package music
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/beep"
+)
+
+// ones streams full scale samples forever and counts how many it streamed
+type ones struct {
+	count int
+}
+
+func (o *ones) Stream(samples [][2]float64) (int, bool) {
+	for i := range samples {
+		samples[i] = [2]float64{1, 1}
+	}
+	o.count += len(samples)
+	return len(samples), true
+}
+
+func (o *ones) Err() error {
+	return nil
+}
+
+func TestFader(t *testing.T) {
+	type step struct {
+		fade   func(f *fader)
+		want   []float64
+		wantOK bool
+	}
+	tests := []struct {
+		name   string
+		fadeIn int
+		steps  []step
+	}{
+		{
+			name:  "no fade in",
+			steps: []step{{nil, []float64{1, 1, 1}, true}},
+		},
+		{
+			name:   "fade in",
+			fadeIn: 4,
+			steps:  []step{{nil, []float64{0.25, 0.5, 0.75, 1, 1, 1}, true}},
+		},
+		{
+			name: "fade out",
+			steps: []step{
+				{func(f *fader) { f.fadeOut(4) }, []float64{0.75, 0.5, 0.25, 0, 0, 0}, true},
+				{nil, []float64{}, false},
+			},
+		},
+		{
+			name:   "fade out while fading in",
+			fadeIn: 4,
+			steps: []step{
+				{nil, []float64{0.25, 0.5}, true},
+				{func(f *fader) { f.fadeOut(2) }, []float64{0.25, 0, 0}, true},
+				{nil, []float64{}, false},
+			},
+		},
+		{
+			name: "stop at once",
+			steps: []step{
+				{func(f *fader) { f.fadeOut(0) }, []float64{0, 0}, true},
+				{nil, []float64{}, false},
+			},
+		},
+		{
+			name: "pause and resume",
+			steps: []step{
+				{func(f *fader) { f.fadePause(4) }, []float64{0.75, 0.5, 0.25, 0, 0}, true},
+				{nil, []float64{0, 0}, true},
+				{func(f *fader) { f.fadeResume(4) }, []float64{0.25, 0.5, 0.75, 1, 1}, true},
+			},
+		},
+		{
+			name: "resume while pausing",
+			steps: []step{
+				{func(f *fader) { f.fadePause(4) }, []float64{0.75, 0.5}, true},
+				{func(f *fader) { f.fadeResume(2) }, []float64{0.75, 1, 1}, true},
+			},
+		},
+		{
+			name: "stop while paused",
+			steps: []step{
+				{func(f *fader) { f.fadePause(0) }, []float64{0, 0}, true},
+				{func(f *fader) { f.fadeOut(4) }, []float64{0, 0}, true},
+				{nil, []float64{}, false},
+			},
+		},
+		{
+			name: "no pause after stopping",
+			steps: []step{
+				{func(f *fader) { f.fadeOut(4) }, []float64{0.75, 0.5}, true},
+				{func(f *fader) { f.fadePause(0); f.fadeResume(0) }, []float64{0.25, 0, 0}, true},
+			},
+		},
+		{
+			name: "resume without pause",
+			steps: []step{
+				{func(f *fader) { f.fadeResume(4) }, []float64{1, 1}, true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFader(&ones{}, tt.fadeIn)
+			for idx, step := range tt.steps {
+				if step.fade != nil {
+					step.fade(f)
+				}
+				samples := make([][2]float64, max(1, len(step.want)))
+				n, ok := f.Stream(samples)
+				if ok != step.wantOK || (ok && n != len(samples)) {
+					t.Fatalf("step %d: Stream() = %d, %v, want %d, %v", idx, n, ok, len(step.want), step.wantOK)
+				}
+				if !ok {
+					continue
+				}
+				for i, want := range step.want {
+					if math.Abs(samples[i][0]-want) > 1e-9 || samples[i][0] != samples[i][1] {
+						t.Errorf("step %d: gain of sample %d = %v, want %v", idx, i, samples[i], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFaderPauseKeepsPosition(t *testing.T) {
+	source := &ones{}
+	f := newFader(source, 0)
+	f.fadePause(0)
+	f.Stream(make([][2]float64, 8))
+	if source.count != 0 {
+		t.Errorf("a paused fader streamed %d samples of its streamer, want 0", source.count)
+	}
+	if !f.isPaused() {
+		t.Errorf("isPaused() = false while paused")
+	}
+	f.fadeResume(0)
+	if f.isPaused() {
+		t.Errorf("isPaused() = true after resuming")
+	}
+}
+
+func TestCue(t *testing.T) {
+	buffer := beep.NewBuffer(beep.Format{SampleRate: testRate, NumChannels: 2, Precision: 2})
+	buffer.Append(beep.Take(10, &ones{}))
+
+	fired := 0
+	c := &cue{Streamer: buffer.Streamer(0, buffer.Len()), at: 3, fn: func() { fired++ }}
+	tests := []struct {
+		samples int
+		want    int
+	}{
+		{4, 0}, // 6 samples left
+		{3, 1}, // 3 samples left
+		{4, 1},
+	}
+	for idx, tt := range tests {
+		c.Stream(make([][2]float64, tt.samples))
+		if fired != tt.want {
+			t.Errorf("step %d: the cue fired %d times, want %d", idx, fired, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package music
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HistoryEntry records a song that has been played
+type HistoryEntry struct {
+	Name     string    `json:"name"`
+	Playlist string    `json:"playlist"`
+	Artist   string    `json:"artist"`
+	Title    string    `json:"title"`
+	Started  time.Time `json:"started"`
+	Skipped  bool      `json:"skipped"`
+}
+
+// The history keeps a bounded list of played songs, which is persisted to a
+// file so that it survives restarts
+type history struct {
+	path     string
+	size     int
+	entries  []HistoryEntry
+	lock     sync.Mutex
+	saveLock sync.Mutex // Keeps concurrent saves from finishing out of order
+}
+
+// newHistory loads the history stored at the given path, if there is one
+func newHistory(path string, size int) *history {
+	h := &history{path: path, size: size, entries: make([]HistoryEntry, 0)}
+	if path == "" {
+		return h
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &h.entries)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file": path,
+			"err":  err,
+		}).Warn("Could not load the music history")
+		h.entries = make([]HistoryEntry, 0)
+	}
+	h.trim()
+	return h
+}
+
+// add appends an entry and drops the oldest ones once the history is full
+func (h *history) add(entry HistoryEntry) {
+	h.lock.Lock()
+	h.entries = append(h.entries, entry)
+	h.trim()
+	h.lock.Unlock()
+	h.save()
+}
+
+// skip marks the most recent entry as skipped
+func (h *history) skip() {
+	h.lock.Lock()
+	if len(h.entries) > 0 {
+		h.entries[len(h.entries)-1].Skipped = true
+	}
+	h.lock.Unlock()
+	h.save()
+}
+
+// list returns a copy of all entries, starting with the most recent one
+func (h *history) list() []HistoryEntry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	entries := make([]HistoryEntry, len(h.entries))
+	for idx := range h.entries {
+		entries[idx] = h.entries[len(h.entries)-1-idx]
+	}
+	return entries
+}
+
+func (h *history) trim() {
+	if h.size > 0 && len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+}
+
+func (h *history) save() {
+	if h.path == "" {
+		return
+	}
+
+	// Entries are only taken once the previous save is done, so the last
+	// save always writes the latest entries
+	h.saveLock.Lock()
+	defer h.saveLock.Unlock()
+	h.lock.Lock()
+	data, err := json.Marshal(h.entries)
+	h.lock.Unlock()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(h.path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(h.path, data, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file": h.path,
+			"err":  err,
+		}).Error("Could not save the music history")
+	}
+}
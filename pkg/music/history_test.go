@@ -0,0 +1,92 @@
+package music
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func historyNames(entries []HistoryEntry) []string {
+	names := make([]string, len(entries))
+	for idx, entry := range entries {
+		names[idx] = entry.Name
+	}
+	return names
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "music", "history.json")
+	h := newHistory(path, 3)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		h.add(HistoryEntry{Name: name})
+	}
+	h.skip()
+
+	tests := []struct {
+		name string
+		h    *history
+	}{
+		{"in memory", h},
+		{"restored", newHistory(path, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.h.list()
+			if got, want := historyNames(entries), []string{"d", "c", "b"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("list() = %v, want %v", got, want)
+			}
+			if len(entries) > 0 && !entries[0].Skipped {
+				t.Errorf("the most recent entry is not marked as skipped")
+			}
+			for _, entry := range entries[1:] {
+				if entry.Skipped {
+					t.Errorf("entry %q is marked as skipped", entry.Name)
+				}
+			}
+		})
+	}
+
+	// A smaller size drops the oldest entries when restoring
+	if got, want := historyNames(newHistory(path, 2).list()), []string{"d", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list() with a smaller size = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("could not write the history: %v", err)
+	}
+	if entries := newHistory(path, 10).list(); len(entries) != 0 {
+		t.Errorf("list() of an invalid file = %v, want no entries", historyNames(entries))
+	}
+	if entries := newHistory(filepath.Join(t.TempDir(), "missing.json"), 10).list(); len(entries) != 0 {
+		t.Errorf("list() of a missing file = %v, want no entries", historyNames(entries))
+	}
+}
+
+func TestHistoryConcurrentSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h := newHistory(path, 100)
+	var wg sync.WaitGroup
+	for idx := 0; idx < 20; idx++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			h.add(HistoryEntry{Name: fmt.Sprintf("song %d", idx)})
+		}()
+		go func() {
+			defer wg.Done()
+			h.skip()
+		}()
+	}
+	wg.Wait()
+
+	// Whatever order the saves ran in, the file ends up with the latest state
+	if got, want := newHistory(path, 100).list(), h.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored history has %d entries that differ from the %d in memory", len(got), len(want))
+	}
+}
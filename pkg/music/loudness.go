@@ -0,0 +1,272 @@
+package music
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dulli/deichwave/pkg/common"
+	"github.com/faiface/beep"
+	log "github.com/sirupsen/logrus"
+)
+
+// Loudness is measured according to ITU-R BS.1770 and songs are normalized to
+// the reference level used by ReplayGain 2.0
+const loudnessReference = -18.0 // [LUFS]
+const r128Reference = -23.0     // [LUFS]
+
+var ErrLoudnessUnknown = errors.New("loudness could not be measured")
+
+// The loudness cache stores the measured loudness of songs without gain
+// tags, so that each of them only has to be analyzed once
+type loudnessCache struct {
+	path    string
+	entries map[string]loudnessEntry
+	lock    sync.Mutex
+}
+
+type loudnessEntry struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Loudness float64   `json:"loudness"`
+}
+
+// newLoudnessCache loads the cache stored at the given path, if there is one
+func newLoudnessCache(path string) *loudnessCache {
+	c := &loudnessCache{path: path, entries: make(map[string]loudnessEntry)}
+	if path == "" {
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &c.entries)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file": path,
+			"err":  err,
+		}).Warn("Could not load the loudness cache")
+		c.entries = make(map[string]loudnessEntry)
+	}
+	return c
+}
+
+// cached returns the gain needed to normalize a song, if it has been measured
+// before and did not change since
+func (c *loudnessCache) cached(path string) (float64, bool) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	c.lock.Lock()
+	entry, ok := c.entries[path]
+	c.lock.Unlock()
+	if !ok || entry.Size != stat.Size() || !entry.Modified.Equal(stat.ModTime()) {
+		return 0, false
+	}
+	return loudnessReference - entry.Loudness, true
+}
+
+// gain returns the gain needed to normalize a song, which is analyzed if it
+// has not been measured before or changed since, so it can take a while
+func (c *loudnessCache) gain(path string) (float64, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	c.lock.Lock()
+	entry, ok := c.entries[path]
+	c.lock.Unlock()
+	if ok && entry.Size == stat.Size() && entry.Modified.Equal(stat.ModTime()) {
+		return loudnessReference - entry.Loudness, nil
+	}
+
+	streamer, format, err := decode(path)
+	if err != nil {
+		return 0, err
+	}
+	defer streamer.Close()
+	loudness, err := measureLoudness(streamer, format.SampleRate)
+	if err != nil {
+		return 0, err
+	}
+	log.WithFields(log.Fields{
+		"file":     path,
+		"loudness": loudness,
+	}).Debug("Analyzed the loudness of a song")
+
+	c.lock.Lock()
+	c.entries[path] = loudnessEntry{Size: stat.Size(), Modified: stat.ModTime(), Loudness: loudness}
+	c.lock.Unlock()
+	c.save()
+	return loudnessReference - loudness, nil
+}
+
+func (c *loudnessCache) save() {
+	if c.path == "" {
+		return
+	}
+
+	c.lock.Lock()
+	data, err := json.Marshal(c.entries)
+	c.lock.Unlock()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.path, data, 0644)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file": c.path,
+			"err":  err,
+		}).Error("Could not save the loudness cache")
+	}
+}
+
+// measureLoudness calculates the gated integrated loudness of a stream
+func measureLoudness(streamer beep.Streamer, rate beep.SampleRate) (float64, error) {
+	filters := [2]*kWeighting{newKWeighting(rate), newKWeighting(rate)}
+
+	// The power is gathered in blocks of 100ms
+	blockLen := rate.N(100 * time.Millisecond)
+	powers := make([]float64, 0)
+	sum, count := 0.0, 0
+	samples := make([][2]float64, 512)
+	for {
+		n, ok := streamer.Stream(samples)
+		for _, sample := range samples[:n] {
+			l := filters[0].process(sample[0])
+			r := filters[1].process(sample[1])
+			sum += l*l + r*r
+			count++
+			if count == blockLen {
+				powers = append(powers, sum/float64(blockLen))
+				sum, count = 0, 0
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return 0, err
+	}
+
+	// Gating blocks are 400ms long and overlap by 75%
+	blocks := make([]float64, 0, len(powers))
+	for i := 0; i+4 <= len(powers); i++ {
+		blocks = append(blocks, (powers[i]+powers[i+1]+powers[i+2]+powers[i+3])/4)
+	}
+
+	gated := gateLoudness(blocks, -70)
+	if len(gated) == 0 {
+		return 0, ErrLoudnessUnknown
+	}
+	gated = gateLoudness(gated, lufs(mean(gated))-10)
+	if len(gated) == 0 {
+		return 0, ErrLoudnessUnknown
+	}
+	return lufs(mean(gated)), nil
+}
+
+func gateLoudness(blocks []float64, threshold float64) []float64 {
+	gated := make([]float64, 0, len(blocks))
+	for _, power := range blocks {
+		if lufs(power) > threshold {
+			gated = append(gated, power)
+		}
+	}
+	return gated
+}
+
+func lufs(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// The k-weighting filter models the perceived loudness, it consists of a high
+// shelf followed by a high pass filter
+type kWeighting struct {
+	shelf    common.Biquad
+	highpass common.Biquad
+}
+
+func newKWeighting(rate beep.SampleRate) *kWeighting {
+	f0 := 1681.974450955533
+	g := 3.999843853973347
+	q := 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / float64(rate))
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := common.Biquad{
+		B0: (vh + vb*k/q + k*k) / a0,
+		B1: 2 * (k*k - vh) / a0,
+		B2: (vh - vb*k/q + k*k) / a0,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / float64(rate))
+	a0 = 1 + k/q + k*k
+	highpass := common.Biquad{
+		B0: 1,
+		B1: -2,
+		B2: 1,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+	return &kWeighting{shelf: shelf, highpass: highpass}
+}
+
+func (k *kWeighting) process(x float64) float64 {
+	return k.highpass.Process(k.shelf.Process(x))
+}
+
+// gainVolume converts a gain in dB to the volume of a base 2 volume streamer
+func gainVolume(gain float64) float64 {
+	return gain / (20 * math.Log10(2))
+}
+
+// normalizeTrack analyzes the loudness of a song that is prepared ahead of
+// time, if it has neither gain tags nor a cached analysis, so that this does
+// not hold up the playback
+func (p *musicPlayer) normalizeTrack(t *track) {
+	path := t.song.getPath()
+	if !p.normalize || t.info.HasGain {
+		return
+	}
+	if _, ok := p.loudness.cached(path); ok {
+		return
+	}
+	gain, err := p.loudness.gain(path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"song": t.song.GetName(),
+			"err":  err,
+		}).Warn("Could not analyze the loudness of a song")
+		return
+	}
+
+	// The song is not playing yet, so its volume can be changed freely
+	t.volume.Volume = gainVolume(gain)
+}
@@ -0,0 +1,48 @@
+package music
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoudnessIsAnalyzedWhenPreloading(t *testing.T) {
+	p := newTestPlayer(t, nil)
+	path := filepath.Join(t.TempDir(), "Party", "Quiet.wav")
+	writeTestSong(t, path, 2*time.Second)
+
+	tr, err := p.load("Party", NewSong("Quiet", path))
+	if err != nil {
+		t.Fatalf("load() failed: %v", err)
+	}
+	defer tr.streamer.Close()
+	if tr.volume.Volume != 0 {
+		t.Errorf("volume before the analysis = %v, want 0", tr.volume.Volume)
+	}
+	if _, ok := p.loudness.cached(path); ok {
+		t.Fatalf("load() analyzed the loudness on the playback path")
+	}
+
+	p.normalizeTrack(tr)
+	gain, ok := p.loudness.cached(path)
+	if !ok {
+		t.Fatalf("normalizeTrack() did not analyze the loudness")
+	}
+	// The test song is a sine wave at -20 dBFS, so it needs to be raised
+	if gain <= 0 {
+		t.Errorf("gain = %v dB, want a positive one", gain)
+	}
+	if got, want := tr.volume.Volume, gainVolume(gain); got != want {
+		t.Errorf("volume after the analysis = %v, want %v", got, want)
+	}
+
+	// Loading it again uses the cached analysis right away
+	again, err := p.load("Party", NewSong("Quiet", path))
+	if err != nil {
+		t.Fatalf("load() failed: %v", err)
+	}
+	defer again.streamer.Close()
+	if got, want := again.volume.Volume, gainVolume(gain); got != want {
+		t.Errorf("volume of the cached song = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,320 @@
+package music
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dulli/deichwave/pkg/common"
+	"github.com/faiface/beep/speaker"
+	log "github.com/sirupsen/logrus"
+)
+
+// The current line of synced lyrics is checked a few times per second, so
+// that it is shown roughly in time
+const lyricsInterval = 100 * time.Millisecond
+
+var ErrLyricsNotFound = errors.New("song has no lyrics")
+
+var lrcTimestamp = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+var lrcWordTimestamp = regexp.MustCompile(`<\d+:\d{1,2}(?:[.:]\d{1,3})?>`)
+var lrcOffset = regexp.MustCompile(`^\[offset:\s*([+-]?\d+)\s*\]$`)
+var lrcTag = regexp.MustCompile(`^\[[a-zA-Z#]+:.*\]$`)
+
+// Lyrics are either synced, i.e. each line has the time at which it is sung,
+// or just the lines of the text
+type Lyrics struct {
+	Synced bool
+	Lines  []LyricsLine
+}
+
+type LyricsLine struct {
+	Time time.Duration
+	Text string
+}
+
+// LyricsProgress is fired whenever another line of synced lyrics is reached
+type LyricsProgress struct {
+	Line int     `json:"line"`
+	Time float64 `json:"time"`
+	Text string  `json:"text"`
+}
+
+// parseLRC parses lyrics in the LRC format, where lines can have multiple
+// timestamps and an offset moves all of them, text without any timestamps is
+// treated as unsynced lyrics
+func parseLRC(text string) Lyrics {
+	text = strings.ReplaceAll(strings.TrimPrefix(text, "\ufeff"), "\r\n", "\n")
+	synced := make([]LyricsLine, 0)
+	plain := make([]LyricsLine, 0)
+	offset := time.Duration(0)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if match := lrcOffset.FindStringSubmatch(strings.ToLower(line)); match != nil {
+			ms, _ := strconv.Atoi(match[1])
+			offset = time.Duration(ms) * time.Millisecond
+			continue
+		}
+
+		times := make([]time.Duration, 0, 1)
+		for {
+			match := lrcTimestamp.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			min, _ := strconv.Atoi(match[1])
+			sec, _ := strconv.Atoi(match[2])
+			ms, _ := strconv.Atoi((match[3] + "000")[:3])
+			times = append(times, time.Duration(min)*time.Minute+time.Duration(sec)*time.Second+time.Duration(ms)*time.Millisecond)
+			line = strings.TrimSpace(line[len(match[0]):])
+		}
+		line = strings.TrimSpace(lrcWordTimestamp.ReplaceAllString(line, ""))
+
+		if len(times) == 0 {
+			if !lrcTag.MatchString(line) {
+				plain = append(plain, LyricsLine{Text: line})
+			}
+			continue
+		}
+		for _, at := range times {
+			synced = append(synced, LyricsLine{Time: at, Text: line})
+		}
+	}
+	if len(synced) == 0 {
+		return Lyrics{Lines: trimLines(plain)}
+	}
+
+	// A positive offset lets the lyrics appear earlier
+	for idx := range synced {
+		synced[idx].Time = max(0, synced[idx].Time-offset)
+	}
+	sort.SliceStable(synced, func(i, j int) bool {
+		return synced[i].Time < synced[j].Time
+	})
+	return Lyrics{Synced: true, Lines: synced}
+}
+
+// trimLines removes empty lines at the start and end of unsynced lyrics
+func trimLines(lines []LyricsLine) []LyricsLine {
+	for len(lines) > 0 && lines[0].Text == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1].Text == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// readLRC reads the lyrics of a song from an .lrc file next to it, that has
+// the same name as the song
+func readLRC(path string) (Lyrics, bool) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".lrc", ".LRC"} {
+		data, err := os.ReadFile(base + ext)
+		if err != nil {
+			continue
+		}
+		text := string(data)
+		if !utf8.ValidString(text) {
+			text = decodeLatin1(data)
+		}
+		lyrics := parseLRC(text)
+		return lyrics, len(lyrics.Lines) > 0
+	}
+	return Lyrics{}, false
+}
+
+// parseSYLT parses the body of a synchronised lyrics ID3 frame, only
+// timestamps in milliseconds are supported
+func parseSYLT(body []byte) (Lyrics, bool) {
+	if len(body) < 6 || body[4] != 2 {
+		return Lyrics{}, false
+	}
+	encoding := body[0]
+	_, data, ok := id3String(encoding, body[6:])
+	if !ok {
+		return Lyrics{}, false
+	}
+
+	entries := make([]LyricsLine, 0)
+	for len(data) > 0 {
+		text, rest, ok := id3String(encoding, data)
+		if !ok || len(rest) < 4 {
+			break
+		}
+		at := time.Duration(binary.BigEndian.Uint32(rest[:4])) * time.Millisecond
+		entries = append(entries, LyricsLine{Time: at, Text: text})
+		data = rest[4:]
+	}
+
+	// Entries are either whole lines, or syllables where each line starts
+	// with a line break
+	broken := false
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Text, "\n") || strings.HasPrefix(entry.Text, "\r") {
+			broken = true
+		}
+	}
+	lines := make([]LyricsLine, 0, len(entries))
+	for _, entry := range entries {
+		newline := strings.HasPrefix(entry.Text, "\n") || strings.HasPrefix(entry.Text, "\r")
+		text := strings.TrimLeft(entry.Text, "\r\n")
+		if broken && !newline && len(lines) > 0 {
+			lines[len(lines)-1].Text += text
+			continue
+		}
+		lines = append(lines, LyricsLine{Time: entry.Time, Text: text})
+	}
+	for idx := range lines {
+		lines[idx].Text = strings.TrimSpace(lines[idx].Text)
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+	return Lyrics{Synced: true, Lines: lines}, len(lines) > 0
+}
+
+// id3String splits a terminated string in the given ID3 text encoding off the
+// start of the data
+func id3String(encoding byte, data []byte) (string, []byte, bool) {
+	switch encoding {
+	case 0, 3:
+		end := 0
+		for end < len(data) && data[end] != 0 {
+			end++
+		}
+		if end == len(data) {
+			return "", nil, false
+		}
+		if encoding == 0 {
+			return decodeLatin1(data[:end]), data[end+1:], true
+		}
+		return string(data[:end]), data[end+1:], true
+	case 1, 2:
+		end := 0
+		for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+			end += 2
+		}
+		if end+1 >= len(data) {
+			return "", nil, false
+		}
+		return decodeUTF16(data[:end], encoding == 2), data[end+2:], true
+	}
+	return "", nil, false
+}
+
+// decodeUTF16 decodes UTF-16 text, which is big endian unless a byte order
+// mark says otherwise
+func decodeUTF16(data []byte, bigEndian bool) string {
+	var order binary.ByteOrder = binary.BigEndian
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe {
+		order, data = binary.LittleEndian, data[2:]
+	} else if len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff {
+		data = data[2:]
+	} else if !bigEndian {
+		order = binary.LittleEndian
+	}
+	units := make([]uint16, len(data)/2)
+	for idx := range units {
+		units[idx] = order.Uint16(data[2*idx:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodeLatin1 decodes ISO-8859-1 text, whose bytes are the first unicode
+// code points
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for idx, b := range data {
+		runes[idx] = rune(b)
+	}
+	return string(runes)
+}
+
+// Lyrics returns the lyrics of a song, preferring an .lrc file next to it
+// over the lyrics in its tags
+func (p *musicPlayer) Lyrics(playlist string, name string) (Lyrics, error) {
+	pl, err := p.GetPlaylist(playlist)
+	if err != nil {
+		return Lyrics{}, err
+	}
+	s, err := pl.GetSong(name)
+	if err != nil {
+		return Lyrics{}, err
+	}
+	if lyrics, ok := readLRC(s.getPath()); ok {
+		return lyrics, nil
+	}
+	sI, err := readTags(s.getPath())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"song": name,
+			"err":  err,
+		}).Warn("Couldnt retrieve media tags")
+	}
+	if len(sI.Lyrics.Lines) == 0 {
+		return Lyrics{}, ErrLyricsNotFound
+	}
+	return sI.Lyrics, nil
+}
+
+// PlayingLyrics returns the lyrics of the current song
+func (p *musicPlayer) PlayingLyrics() (Lyrics, error) {
+	np := p.NowPlaying()
+	if np.path == "" {
+		return Lyrics{}, ErrNothingPlaying
+	}
+	if len(np.Lyrics.Lines) == 0 {
+		return Lyrics{}, ErrLyricsNotFound
+	}
+	return np.Lyrics, nil
+}
+
+// followLyrics fires an event whenever another line of the synced lyrics of
+// the current song is reached, which also picks up seeking
+func (p *musicPlayer) followLyrics() {
+	var last *track
+	lastLine := -1
+	ticker := time.NewTicker(lyricsInterval)
+	for range ticker.C {
+		speaker.Lock()
+		t := p.current
+		playing := t != nil && !t.fader.isPaused()
+		var position time.Duration
+		if playing {
+			position = t.format.SampleRate.D(t.streamer.Position())
+		}
+		speaker.Unlock()
+		if !playing || !t.info.Lyrics.Synced {
+			continue
+		}
+
+		lines := t.info.Lyrics.Lines
+		line := sort.Search(len(lines), func(idx int) bool {
+			return lines[idx].Time > position
+		}) - 1
+		if t == last && line == lastLine {
+			continue
+		}
+		last, lastLine = t, line
+
+		progress := LyricsProgress{Line: line}
+		if line >= 0 {
+			progress.Time = lines[line].Time.Seconds()
+			progress.Text = lines[line].Text
+		}
+		common.EventFire(common.Event{
+			Origin: "music",
+			Type:   "lyrics",
+			Data:   progress,
+		})
+	}
+}
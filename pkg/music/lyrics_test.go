@@ -0,0 +1,160 @@
+package music
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLRC(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		text string
+		want Lyrics
+	}{
+		{
+			name: "synced",
+			text: "[ar:Artist]\n[ti:Title]\n[00:01.50]First\n[00:03.25]Second\n",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{1500 * ms, "First"}, {3250 * ms, "Second"}}},
+		},
+		{
+			name: "timestamp precision",
+			text: "[01:02]Minutes\n[00:01.5]Tenths\n[00:02:123]Milliseconds",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{1500 * ms, "Tenths"}, {2123 * ms, "Milliseconds"}, {62 * time.Second, "Minutes"}}},
+		},
+		{
+			name: "multiple timestamps",
+			text: "[00:10.00][00:02.00]Chorus\n[00:05.00]Verse",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{2 * time.Second, "Chorus"}, {5 * time.Second, "Verse"}, {10 * time.Second, "Chorus"}}},
+		},
+		{
+			name: "offset",
+			text: "[offset:+500]\n[00:00.20]Early\n[00:02.00]Later",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{0, "Early"}, {1500 * ms, "Later"}}},
+		},
+		{
+			name: "negative offset",
+			text: "[Offset: -250]\n[00:01.00]Late",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{1250 * ms, "Late"}}},
+		},
+		{
+			name: "word timestamps",
+			text: "[00:01.00]<00:01.00>Every <00:01.50>word <00:02.00>timed",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{time.Second, "Every word timed"}}},
+		},
+		{
+			name: "byte order mark and windows line breaks",
+			text: "\ufeff[00:01.00]One\r\n[00:02.00]Two\r\n",
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{time.Second, "One"}, {2 * time.Second, "Two"}}},
+		},
+		{
+			name: "unsynced",
+			text: "\n[ar:Artist]\nFirst line\n\nSecond line\n\n",
+			want: Lyrics{Lines: []LyricsLine{{0, "First line"}, {0, ""}, {0, "Second line"}}},
+		},
+		{
+			name: "empty",
+			text: "",
+			want: Lyrics{Lines: []LyricsLine{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLRC(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLRC() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// syltFrame builds the body of a SYLT frame with Latin-1 text and timestamps
+// in milliseconds
+func syltFrame(format byte, entries ...LyricsLine) []byte {
+	body := []byte{0, 'e', 'n', 'g', format, 1}
+	body = append(body, "Description"...)
+	body = append(body, 0)
+	for _, entry := range entries {
+		body = append(body, entry.Text...)
+		body = append(body, 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(entry.Time/time.Millisecond))
+	}
+	return body
+}
+
+func TestParseSYLT(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want Lyrics
+		ok   bool
+	}{
+		{
+			name: "lines",
+			body: syltFrame(2, LyricsLine{2 * time.Second, "Second"}, LyricsLine{time.Second, " First "}),
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{time.Second, "First"}, {2 * time.Second, "Second"}}},
+			ok:   true,
+		},
+		{
+			name: "syllables",
+			body: syltFrame(2,
+				LyricsLine{time.Second, "\nHel"}, LyricsLine{1200 * time.Millisecond, "lo "},
+				LyricsLine{1500 * time.Millisecond, "world"}, LyricsLine{3 * time.Second, "\rAgain"}),
+			want: Lyrics{Synced: true, Lines: []LyricsLine{{time.Second, "Hello world"}, {3 * time.Second, "Again"}}},
+			ok:   true,
+		},
+		{
+			name: "truncated timestamp",
+			body: syltFrame(2, LyricsLine{time.Second, "Complete"})[:len(syltFrame(2, LyricsLine{time.Second, "Complete"}))-1],
+			want: Lyrics{},
+		},
+		{
+			name: "frames instead of milliseconds",
+			body: syltFrame(1, LyricsLine{time.Second, "Frames"}),
+			want: Lyrics{},
+		},
+		{
+			name: "too short",
+			body: []byte{0, 'e', 'n'},
+			want: Lyrics{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSYLT(tt.body)
+			if ok != tt.ok {
+				t.Fatalf("parseSYLT() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSYLT() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlayerLyrics(t *testing.T) {
+	root := t.TempDir()
+	writeTestSong(t, filepath.Join(root, "Party", "a.wav"), 10*time.Millisecond)
+	writeTestSong(t, filepath.Join(root, "Party", "b.wav"), 10*time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "Party", "a.lrc"), []byte("[00:01.00]M\xf6we"), 0644); err != nil {
+		t.Fatalf("could not write the lyrics: %v", err)
+	}
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+
+	lyrics, err := p.Lyrics("Party", "a")
+	if err != nil {
+		t.Fatalf("Lyrics() failed: %v", err)
+	}
+	if want := []LyricsLine{{time.Second, "Möwe"}}; !lyrics.Synced || !reflect.DeepEqual(lyrics.Lines, want) {
+		t.Errorf("Lyrics() = %+v, want the synced line %+v", lyrics, want)
+	}
+	if _, err := p.Lyrics("Party", "b"); err != ErrLyricsNotFound {
+		t.Errorf("Lyrics() without lyrics = %v, want %v", err, ErrLyricsNotFound)
+	}
+}
@@ -0,0 +1,127 @@
+package music
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrPlaylistFileInvalid = errors.New("playlist file could not be read")
+
+// isPlaylistFile checks whether a file is an M3U playlist
+func isPlaylistFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".m3u" || ext == ".m3u8"
+}
+
+// readM3U returns the paths of all entries of an M3U playlist, relative paths
+// are resolved against the directory of the playlist file
+func readM3U(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	paths := make([]string, 0)
+	dir := filepath.Dir(path)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Plain .m3u files are usually Latin-1 encoded
+		if !utf8.ValidString(line) {
+			line = decodeLatin1([]byte(line))
+		}
+		if strings.HasPrefix(line, "file://") {
+			u, err := url.Parse(line)
+			if err != nil {
+				continue
+			}
+			line = u.Path
+		}
+
+		entry := filepath.FromSlash(line)
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(dir, entry)
+		}
+		paths = append(paths, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ErrPlaylistFileInvalid
+	}
+	return paths, nil
+}
+
+// ExportPlaylist writes a playlist as an UTF-8 encoded M3U playlist, the paths
+// are relative to the music directory, so that the file can be put there.
+func (p *musicPlayer) ExportPlaylist(name string, w io.Writer) error {
+	pl, err := p.GetPlaylist(name)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "#EXTM3U")
+	fmt.Fprintf(out, "#PLAYLIST:%s\n", name)
+	for _, s := range pl.songs() {
+		path, err := filepath.Rel(p.root, s.getPath())
+		if err != nil {
+			path = s.getPath()
+		}
+		title := s.GetName()
+		if s.GetTitle() != "" {
+			title = s.GetTitle()
+			if s.GetArtist() != "" {
+				title = s.GetArtist() + " - " + title
+			}
+		}
+		fmt.Fprintf(out, "#EXTINF:-1,%s\n", title)
+		fmt.Fprintln(out, filepath.ToSlash(path))
+	}
+	return out.Flush()
+}
+
+// scanPlaylistFile returns all music files of an M3U playlist that exist
+func (p *musicPlayer) scanPlaylistFile(list string, path string) ([]string, error) {
+	entries, err := readM3U(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		if !p.isMusicFile(entry) {
+			log.WithFields(log.Fields{
+				"list": list,
+				"file": entry,
+			}).Warn("Skipped a playlist entry that is not a music file")
+			continue
+		}
+		if _, err := os.Stat(entry); err != nil {
+			log.WithFields(log.Fields{
+				"list": list,
+				"file": entry,
+			}).Warn("Skipped a playlist entry that could not be found")
+			continue
+		}
+		paths = append(paths, entry)
+	}
+	return paths, nil
+}
@@ -0,0 +1,111 @@
+package music
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsPlaylistFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/music/Party.m3u", true},
+		{"/music/Party.m3u8", true},
+		{"/music/Party.M3U", true},
+		{"/music/Party.mp3", false},
+		{"/music/m3u", false},
+	}
+	for _, tt := range tests {
+		if got := isPlaylistFile(tt.path); got != tt.want {
+			t.Errorf("isPlaylistFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestReadM3U(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "extended playlist",
+			content: "#EXTM3U\n#EXTINF:-1,Artist - Title\nsongs/a.mp3\n\n#EXTINF:-1,Other\nb.mp3\n",
+			want:    []string{filepath.Join(dir, "songs", "a.mp3"), filepath.Join(dir, "b.mp3")},
+		},
+		{
+			name:    "absolute paths and urls",
+			content: "/music/a.mp3\r\nfile:///music/with%20space.mp3\r\n",
+			want:    []string{"/music/a.mp3", "/music/with space.mp3"},
+		},
+		{
+			name:    "byte order mark and whitespace",
+			content: "\ufeff  a.mp3  \n",
+			want:    []string{filepath.Join(dir, "a.mp3")},
+		},
+		{
+			name:    "latin-1",
+			content: "M\xf6we.mp3\n",
+			want:    []string{filepath.Join(dir, "Möwe.mp3")},
+		},
+		{
+			name:    "utf-8",
+			content: "Möwe.mp3\n",
+			want:    []string{filepath.Join(dir, "Möwe.mp3")},
+		},
+		{
+			name:    "only comments",
+			content: "#EXTM3U\n# nothing here\n",
+			want:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "list.m3u")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("could not write the playlist: %v", err)
+			}
+			got, err := readM3U(path)
+			if err != nil {
+				t.Fatalf("readM3U() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readM3U() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readM3U(filepath.Join(dir, "missing.m3u")); err == nil {
+		t.Errorf("readM3U() of a missing file succeeded")
+	}
+}
+
+func TestLoadPlaylistFile(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		writeTestSong(t, filepath.Join(root, "Party", name+".wav"), 10*time.Millisecond)
+	}
+	content := "#EXTM3U\nParty/b.wav\nParty/b.wav\nParty/missing.wav\nParty/cover.jpg\nParty/a.wav\n"
+	if err := os.WriteFile(filepath.Join(root, "Mix.m3u"), []byte(content), 0644); err != nil {
+		t.Fatalf("could not write the playlist: %v", err)
+	}
+
+	// Duplicates, missing files and other files are skipped
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	pl, err := p.GetPlaylist("Mix")
+	if err != nil {
+		t.Fatalf("GetPlaylist() failed: %v", err)
+	}
+	songs := pl.ListSongs()
+	if len(songs) != 2 {
+		t.Errorf("songs of the playlist file = %v, want a and b", songs)
+	}
+}
@@ -2,13 +2,14 @@ package music
 
 import (
 	"errors"
+	"io"
 	"io/fs"
-	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dulli/deichwave/pkg/common"
@@ -16,84 +17,220 @@ import (
 
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/flac"
 	"github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/speaker"
 	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
 )
 
 var ErrPlaylistNotFound = errors.New("playlist could not be found")
+var ErrSongNotFound = errors.New("song could not be found")
+var ErrFormatUnsupported = errors.New("audio format is not supported")
+var ErrNothingPlaying = errors.New("no song is playing")
+
+// Progress events are fired periodically while a song is playing
+const progressInterval = time.Second
 
 type MusicPlayer interface {
 	ListPlaylists() []string
 	GetPlaylist(name string) (Playlist, error)
 	LoadPlaylists(root string) error
+	ExportPlaylist(name string, w io.Writer) error
+	Cover(playlist string, name string, size int) (Cover, error)
+	PlayingCover(size int) (Cover, error)
+	Lyrics(playlist string, name string) (Lyrics, error)
+	PlayingLyrics() (Lyrics, error)
+	Rescan() error
 	Play()
 	Pause()
 	Stop()
 	Next()
 	NowPlaying() SongInfo
+	Position() time.Duration
+	Duration() time.Duration
+	Seek(position time.Duration) error
+	UpNext() SongInfo
+	Enqueue(playlist string, name string) error
+	ListQueue() []QueueEntry
+	MoveQueued(from int, to int) error
+	Dequeue(index int) error
+	History() []HistoryEntry
+	Search(query string) []SearchResult
 	GetChance(name string) (int, error)
+	ChanceTable() []PlaylistChances
+	CheckChances() error
 }
 
 // The player keeps track of the available playlists
 type musicPlayer struct {
-	Name            string
-	list            map[string]Playlist
-	rate            beep.SampleRate
-	quality         int
-	ext             string
-	nextSong        chan bool
-	keys            []string
-	chances         []int
-	chancesMin      []int
-	chancesMax      []int
-	volume          int
-	currentPlaylist string
-	control         *beep.Ctrl
-	nowPlaying      SongInfo
-	rng             *rand.Rand
+	Name             string
+	list             map[string]Playlist
+	rate             beep.SampleRate
+	quality          int
+	ext              []string
+	nextSong         chan bool
+	keys             []string
+	root             string
+	listLock         sync.RWMutex
+	scanLock         sync.Mutex // Only one scan of the music directory at a time
+	chancesMin       []int
+	chancesMax       []int
+	weights          map[string]chanceCurve
+	crossfade        int
+	fade             int
+	normalize        bool
+	loudness         *loudnessCache
+	covers           *coverCache
+	analysis         *analysisIndex
+	analyzeRequest   chan bool
+	energyWindow     int
+	artistSeparation int
+	modes            map[string]string
+	markers          map[string]string
+	orderedMarker    string
+	singleMarker     string
+	titleSeparation  int
+	currentPlaylist  string
+	current          *track
+	upNext           *track
+	queue            []*queueEntry
+	nextLock         sync.Mutex
+	startLock        sync.Mutex
+	nowPlaying       SongInfo
+	history          *history
+	rng              *rand.Rand
+	rngLock          sync.Mutex
+}
+
+// A track is a decoded song that is ready to be, or currently is, mixed into
+// the speaker output
+type track struct {
+	song     Song
+	info     SongInfo
+	streamer beep.StreamSeekCloser
+	format   beep.Format
+	stream   beep.Streamer
+	volume   *effects.Volume
+	control  *beep.Ctrl
+	fader    *fader
+	finished bool
 }
 
 func NewPlayer(name string, cfg *common.Config) (MusicPlayer, error) {
 	player := musicPlayer{
-		Name:       name,
-		list:       make(map[string]Playlist),
-		rate:       beep.SampleRate(cfg.Audio.Rate),
-		quality:    cfg.Audio.Quality,
-		ext:        cfg.Music.Ext,
-		nextSong:   make(chan bool),
-		chancesMin: cfg.Music.StartRNG,
-		chancesMax: cfg.Music.EndRNG,
-		volume:     cfg.Music.Volume,
-		control:    nil,
-		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
-	}
-	_, err := common.GetSpeaker(player.rate, cfg.Audio.Buffer, cfg.Audio.Volume)
+		Name:             name,
+		list:             make(map[string]Playlist),
+		rate:             beep.SampleRate(cfg.Audio.Rate),
+		quality:          cfg.Audio.Quality,
+		ext:              cfg.Music.Ext,
+		nextSong:         make(chan bool),
+		crossfade:        cfg.Music.Crossfade,
+		fade:             cfg.Music.Fade,
+		normalize:        cfg.Music.Normalize,
+		loudness:         newLoudnessCache(cfg.Music.Loudness),
+		covers:           newCoverCache(),
+		analysis:         newAnalysisIndex(cfg.Music.Analysis),
+		current:          nil,
+		history:          newHistory(cfg.Music.History, cfg.Music.HistorySize),
+		rng:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		analyzeRequest:   make(chan bool, 1),
+		energyWindow:     cfg.Music.EnergyWindow,
+		artistSeparation: cfg.Music.ArtistSeparation,
+		titleSeparation:  cfg.Music.TitleSeparation,
+		markers:          make(map[string]string),
+		orderedMarker:    cfg.Music.Ordered,
+		singleMarker:     cfg.Music.Single,
+	}
+	player.configureChances(cfg)
+	_, err := common.GetSpeaker(player.rate, cfg.Audio.Buffer, cfg.Audio.Volume, cfg.Audio.Device)
 
 	common.ConfigChangeListener(func() {
-		player.chancesMin = cfg.Music.StartRNG
-		player.chancesMax = cfg.Music.EndRNG
-		player.updateChances()
+		player.configureChances(cfg)
+		player.crossfade = cfg.Music.Crossfade
+		player.fade = cfg.Music.Fade
+		player.normalize = cfg.Music.Normalize
+		player.energyWindow = cfg.Music.EnergyWindow
+		player.artistSeparation = cfg.Music.ArtistSeparation
+		player.titleSeparation = cfg.Music.TitleSeparation
+		player.orderedMarker = cfg.Music.Ordered
+		player.singleMarker = cfg.Music.Single
+		player.CheckChances()
+		// Listeners run inside the event loop, which can not take the events
+		// of the playlists until they return
+		go player.applyModes()
 	})
 
 	go player.run()
+	go player.progress()
+	go player.followLyrics()
+	go player.analyzer()
 	return &player, err
 }
 
 // Gather all available playlists
 func (p *musicPlayer) ListPlaylists() []string {
+	p.listLock.RLock()
+	defer p.listLock.RUnlock()
 	return p.keys
 }
 
 func (p *musicPlayer) GetPlaylist(name string) (Playlist, error) {
+	p.listLock.RLock()
+	defer p.listLock.RUnlock()
 	if val, ok := p.list[name]; ok {
 		return val, nil
 	}
 	return nil, ErrPlaylistNotFound
 }
 
-func (p *musicPlayer) LoadPlaylists(root string) error {
-	root = filepath.Clean(root)
+// newPlaylist creates an empty playlist that prefers songs matching the
+// intensity and the separation rules
+func (p *musicPlayer) newPlaylist(name string, scanned *scannedPlaylist) *playlist {
+	return &playlist{Name: name, Songs: make([]Song, 0), Pos: 0, file: scanned.file, prefer: p.preferNext}
+}
+
+// playlistMode determines how a playlist is played, the config takes
+// precedence over marker files
+func (p *musicPlayer) playlistMode(name string) string {
+	if mode, ok := p.modes[name]; ok {
+		return mode
+	}
+	if marker := p.markers[name]; marker != "" {
+		return marker
+	}
+	return ModeShuffle
+}
+
+// applyModes updates the mode of all playlists after the config changed
+func (p *musicPlayer) applyModes() {
+	p.listLock.RLock()
+	lists := make(map[string]Playlist, len(p.list))
+	modes := make(map[string]string, len(p.list))
+	for name, pl := range p.list {
+		lists[name] = pl
+		modes[name] = p.playlistMode(name)
+	}
+	p.listLock.RUnlock()
+
+	for name, pl := range lists {
+		pl.setMode(modes[name])
+	}
+}
+
+// A scanned playlist contains the paths of all its music files and the mode
+// requested by a marker file
+type scannedPlaylist struct {
+	paths  []string
+	file   bool
+	marker string
+}
+
+// scan walks the music directory and returns the paths of all music files,
+// grouped by the playlist they belong to
+func (p *musicPlayer) scan(root string) (map[string]*scannedPlaylist, error) {
+	found := make(map[string]*scannedPlaylist)
+	playlistFiles := make([]string, 0)
 
 	// Add the directories as playlists
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
@@ -101,133 +238,326 @@ func (p *musicPlayer) LoadPlaylists(root string) error {
 			return err
 		}
 		if !d.IsDir() {
+			if filepath.Dir(path) == root && isPlaylistFile(path) {
+				playlistFiles = append(playlistFiles, path)
+			}
 			return nil
 		}
 		if path == root {
 			return nil
 		}
+		// Subfolders, e.g. albums, are part of the playlist they are in
+		if filepath.Dir(path) != root {
+			return fs.SkipDir
+		}
 
 		directory := filepath.Base(path)
-		p.list[directory] = &playlist{Name: directory, Songs: make([]Song, 0), Pos: 0}
+		found[directory] = &scannedPlaylist{paths: make([]string, 0)}
 		log.WithFields(log.Fields{
 			"list": directory,
-		}).Debug("Added a playlist")
+		}).Debug("Found a playlist")
 		return nil
 	})
 
 	// Add the directoriy contents as songs to the playlists
-	var allSongs []string
-	keys := make([]string, 0, len(p.list))
-	for key := range p.list {
+	allSongs := make(map[string]bool)
+	keys := make([]string, 0, len(found))
+	for key := range found {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 	skippedDuplicates := 0
 	for _, key := range keys {
-		p.keys = append(p.keys, key)
 		directory := filepath.Join(root, key)
-		err = filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		walkerr := filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
 			if d.IsDir() {
 				return nil
 			}
-			if filepath.Ext(path) != p.ext {
+			if filepath.Dir(path) == directory {
+				switch d.Name() {
+				case p.orderedMarker:
+					found[key].marker = ModeOrdered
+				case p.singleMarker:
+					found[key].marker = ModeSingle
+				}
+			}
+			if !p.isMusicFile(path) {
 				return nil
 			}
 
 			fname := filepath.Base(path)
-			for _, aname := range allSongs {
-				if aname == fname {
-					log.WithFields(log.Fields{
-						"list": key,
-						"name": fname,
-					}).Debug("Skipped duplicate music file")
-					skippedDuplicates += 1
-					return nil
-				}
+			if allSongs[fname] {
+				log.WithFields(log.Fields{
+					"list": key,
+					"name": fname,
+				}).Debug("Skipped duplicate music file")
+				skippedDuplicates += 1
+				return nil
 			}
-			allSongs = append(allSongs, fname)
-			song := NewSong(fname[:strings.LastIndexByte(fname, '.')], path)
-			p.list[key].addSong(song)
-
-			log.WithFields(log.Fields{
-				"list": key,
-				"file": path,
-			}).Debug("Added a music file")
+			allSongs[fname] = true
+			found[key].paths = append(found[key].paths, path)
 			return nil
 		})
-		p.list[key].shuffle()
+		if err == nil {
+			err = walkerr
+		}
 	}
 	if skippedDuplicates > 0 {
 		log.WithFields(log.Fields{
 			"count": skippedDuplicates,
 		}).Warn("Skipped duplicate music files")
 	}
+
+	// Add the playlist files, which may share songs with other playlists
+	for _, path := range playlistFiles {
+		fname := filepath.Base(path)
+		name := fname[:strings.LastIndexByte(fname, '.')]
+		if _, ok := found[name]; ok {
+			log.WithFields(log.Fields{
+				"list": name,
+				"file": path,
+			}).Warn("Skipped a playlist file with the name of another playlist")
+			continue
+		}
+		paths, fileerr := p.scanPlaylistFile(name, path)
+		if fileerr != nil {
+			log.WithFields(log.Fields{
+				"list": name,
+				"file": path,
+				"err":  fileerr,
+			}).Error("Could not read a playlist file")
+			continue
+		}
+		found[name] = &scannedPlaylist{paths: paths, file: true}
+		log.WithFields(log.Fields{
+			"list": name,
+			"file": path,
+		}).Debug("Found a playlist file")
+	}
+	return found, err
+}
+
+// indexSong creates a song for a music file and indexes its tags once, so
+// that they can be searched
+func (p *musicPlayer) indexSong(list string, path string) Song {
+	fname := filepath.Base(path)
+	song := NewSong(fname[:strings.LastIndexByte(fname, '.')], path)
+	sI, tagerr := readTags(path)
+	if tagerr != nil {
+		log.WithFields(log.Fields{
+			"file": path,
+			"err":  tagerr,
+		}).Debug("Could not index all media tags")
+	}
+	song.setTags(sI.Artist, sI.Title, sI.Track)
+
+	log.WithFields(log.Fields{
+		"list": list,
+		"file": path,
+	}).Debug("Added a music file")
+	return song
+}
+
+// sortKeys rebuilds the sorted list of playlist names, the list lock has to
+// be held by the caller
+func (p *musicPlayer) sortKeys() {
+	p.keys = make([]string, 0, len(p.list))
+	for key := range p.list {
+		p.keys = append(p.keys, key)
+	}
 	sort.Strings(p.keys)
-	return err
 }
 
+// isMusicFile checks whether a file has one of the configured extensions
+func (p *musicPlayer) isMusicFile(path string) bool {
+	for _, ext := range p.ext {
+		if filepath.Ext(path) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Next switches to the next requested song, or the one that is up next, and
+// prepares the one after it
 func (p *musicPlayer) Next() {
-	// use rng to determine next playlist
+	p.nextLock.Lock()
+	var t *track
+	var req *queueEntry
+	if len(p.queue) > 0 {
+		req = p.queue[0]
+		p.queue = p.queue[1:]
+		t = req.track
+	} else {
+		t = p.upNext
+		p.upNext = nil
+	}
+	p.nextLock.Unlock()
+
+	go func() {
+		// Listeners may call back into the player, so the queue is announced
+		// outside of the caller
+		if req != nil {
+			common.EventFire(common.Event{
+				Origin: "music",
+				Type:   "queue",
+			})
+		}
+		if t == nil && req != nil {
+			var err error
+			t, err = p.load(req.playlist, req.song)
+			if err != nil {
+				p.Next()
+				return
+			}
+		}
+		if t == nil {
+			t = p.prepare()
+		}
+		if t == nil {
+			log.Error("Could not find a playable song")
+			return
+		}
+		p.start(t)
+		p.preload()
+	}()
+}
+
+// pick uses the rng to determine the next playlist and returns its next song
+func (p *musicPlayer) pick() (string, Song) {
+	p.listLock.RLock()
 	maxrng := 0
-	p.updateChances()
-	for _, c := range p.chances {
+	chances := p.chancesAt(common.GetIntensity())
+	for _, c := range chances {
 		maxrng += c
 	}
+	if maxrng <= 0 {
+		p.listLock.RUnlock()
+		return "", nil
+	}
+	p.rngLock.Lock()
 	random := p.rng.Intn(maxrng)
+	p.rngLock.Unlock()
 	log.WithFields(log.Fields{
-		"chances": p.chances,
+		"chances": chances,
 		"maxrng":  maxrng,
 		"random":  random,
 	}).Debug("RNG Result")
 
 	playlistIndex := 0
 	level := 0
-	for _, chance := range p.chances {
+	for _, chance := range chances {
 		level += chance
-		if random <= level {
+		if random < level {
 			break
 		}
 		playlistIndex += 1
 	}
-	p.currentPlaylist = p.keys[playlistIndex]
-	pl := p.list[p.currentPlaylist]
-	song := pl.Next()
-	go p.play(song)
+	name := p.keys[playlistIndex]
+	pl := p.list[name]
+	p.listLock.RUnlock()
+
+	// The playlist fires events, which must not happen while holding the lock
+	return name, pl.Next()
 }
 
-func (p *musicPlayer) play(s Song) {
-	data, err := os.Open(s.getPath())
-	if err != nil {
-		log.WithFields(log.Fields{
-			"song": s.GetName(),
-			"err":  err,
-		}).Error("Song not found")
+// prepare picks songs until one of them could be decoded
+func (p *musicPlayer) prepare() *track {
+	total := 0
+	p.listLock.RLock()
+	for _, pl := range p.list {
+		total += len(pl.ListSongs())
+	}
+	p.listLock.RUnlock()
+	for attempt := 0; attempt < total; attempt++ {
+		name, s := p.pick()
+		if s == nil {
+			continue
+		}
+		t, err := p.load(name, s)
+		if err == nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// preload prepares the song that is up next in the background, so that the
+// player can switch to it without any gaps
+func (p *musicPlayer) preload() {
+	p.preloadRequest()
+
+	p.nextLock.Lock()
+	prepared := p.upNext != nil
+	p.nextLock.Unlock()
+	if prepared {
 		return
 	}
 
-	var streamer beep.StreamSeekCloser
-	var format beep.Format
-	switch filepath.Ext(s.getPath()) {
-	case ".mp3":
-		streamer, format, err = mp3.Decode(data)
-	case ".ogg":
-		streamer, format, err = vorbis.Decode(data)
+	t := p.prepare()
+	if t == nil {
+		return
 	}
-	if err != nil {
+	p.normalizeTrack(t)
+
+	p.nextLock.Lock()
+	if p.upNext != nil {
+		p.nextLock.Unlock()
+		t.streamer.Close()
+		return
+	}
+	p.upNext = t
+	p.nextLock.Unlock()
+
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "upnext",
+	})
+	log.WithFields(log.Fields{
+		"name": t.song.GetName(),
+	}).Debug("Prepared the next song")
+}
+
+// load opens and decodes a song and gathers its meta data
+func (p *musicPlayer) load(playlist string, s Song) (*track, error) {
+	streamer, format, err := decode(s.getPath())
+	if errors.Is(err, os.ErrNotExist) {
+		log.WithFields(log.Fields{
+			"song": s.GetName(),
+			"err":  err,
+		}).Error("Song not found")
+		return nil, err
+	} else if err != nil {
 		log.WithFields(log.Fields{
 			"song": s.GetName(),
 			"err":  err,
 		}).Error("Could not decode song")
-		p.Next()
-		return
+		return nil, err
+	}
+
+	// When crossfading, the next song is requested shortly before this one ends
+	t := &track{song: s, streamer: streamer, format: format}
+	var source beep.Streamer = streamer
+	if p.crossfade > 0 {
+		cueLen := format.SampleRate.N(time.Duration(p.crossfade) * time.Second)
+		if cueLen > streamer.Len()/3 {
+			cueLen = streamer.Len() / 3
+		}
+		source = &cue{Streamer: streamer, at: cueLen, fn: func() {
+			t.finished = true
+			log.WithFields(log.Fields{
+				"name": s.GetName(),
+			}).Debug("Crossfading into the next song")
+			go func() { p.nextSong <- true }()
+		}}
 	}
 
-	var volstreamer beep.Streamer = streamer
+	var volstreamer beep.Streamer = source
 	if p.rate != format.SampleRate {
-		volstreamer = beep.Resample(4, format.SampleRate, p.rate, streamer)
+		volstreamer = beep.Resample(4, format.SampleRate, p.rate, source)
 
 		log.WithFields(log.Fields{
 			"song": s.GetName(),
@@ -236,61 +566,158 @@ func (p *musicPlayer) play(s Song) {
 		}).Debug("Resampling song")
 	}
 
-	volume := &effects.Volume{
+	// Gather meta data for the song
+	sI, tagerr := readTags(s.getPath())
+	if tagerr != nil {
+		log.WithFields(log.Fields{
+			"err": tagerr,
+		}).Error("Couldnt retrieve media tags")
+	}
+	sI.Name = s.GetName()
+	sI.Playlist = playlist
+	sI.BPM, sI.Energy, _ = p.analysis.get(s.getPath())
+	sI.path = s.getPath()
+	if lyrics, ok := readLRC(sI.path); ok {
+		sI.Lyrics = lyrics
+	}
+	if entry, err := p.covers.lookup(sI.path, &sI.Picture); err == nil && entry.cover != nil {
+		sI.Cover = entry.cover.ETag
+	}
+	t.info = sI
+
+	// Normalize the loudness using the gain tags or a cached analysis of the
+	// song, songs that were not analyzed yet are played as they are until
+	// they are preloaded
+	gain := 0.0
+	if p.normalize && sI.HasGain {
+		gain = sI.Gain
+	} else if p.normalize {
+		gain, _ = p.loudness.cached(s.getPath())
+	}
+
+	t.volume = &effects.Volume{
 		Streamer: volstreamer,
 		Base:     2,
-		Volume:   math.Log2(float64(p.volume) / 100),
+		Volume:   gainVolume(gain),
 		Silent:   false,
 	}
-	if p.control != nil {
-		speaker.Lock()
-		p.control.Streamer = nil
-		p.control = nil
-		speaker.Unlock()
-	}
-	p.control = &beep.Ctrl{Streamer: beep.Seq(volume, beep.Callback(func() {
-		streamer.Close()
-		log.WithFields(log.Fields{
-			"name": s.GetName(),
-		}).Debug("Finished a song")
+	t.stream = t.volume
+	return t, nil
+}
 
-		p.nextSong <- true
-	})), Paused: false}
-	common.Play(p.control)
+// decode opens a music file and decodes it according to its file type
+func decode(path string) (beep.StreamSeekCloser, beep.Format, error) {
+	data, err := os.Open(path)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
 
-	// Gather meta data for current song
-	var sI SongInfo
-	var tagerr error
-	switch filepath.Ext(s.getPath()) {
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+	switch filepath.Ext(path) {
 	case ".mp3":
-		sI, tagerr = tags_mp3(s.getPath())
+		streamer, format, err = mp3.Decode(data)
 	case ".ogg":
-		sI, tagerr = tags_ogg(s.getPath())
+		streamer, format, err = vorbis.Decode(data)
+	case ".flac":
+		streamer, format, err = flac.Decode(data)
+	case ".wav":
+		streamer, format, err = wav.Decode(data)
+	default:
+		err = ErrFormatUnsupported
 	}
-	if tagerr != nil {
-		log.WithFields(log.Fields{
-			"err": tagerr,
-		}).Error("Couldnt retrieve media tags")
+	if err != nil {
+		data.Close()
+		return nil, beep.Format{}, err
 	}
-	sI.Playlist = p.currentPlaylist
-	p.nowPlaying = sI
+	return streamer, format, nil
+}
+
+// start mixes a loaded track into the speaker output, replacing the current one
+func (p *musicPlayer) start(t *track) {
+	// Songs are started one at a time, so that concurrent calls to Next can
+	// not end up playing two of them
+	p.startLock.Lock()
+	defer p.startLock.Unlock()
+
+	fadeLen := p.rate.N(time.Duration(p.crossfade) * time.Second)
+	t.fader = newFader(t.stream, 0)
+	speaker.Lock()
+	skipped := false
+	if p.current != nil {
+		skipped = !p.current.finished
+		p.current.finished = true
+		if p.crossfade > 0 {
+			p.current.fader.fadeOut(fadeLen)
+			t.fader = newFader(t.stream, fadeLen)
+		} else if skipped {
+			// Songs that are skipped without a crossfade are still faded
+			// out briefly, so that they do not end with a click
+			p.current.fader.fadeOut(p.fadeLen())
+			t.fader = newFader(t.stream, p.fadeLen())
+		} else {
+			p.current.control.Streamer = nil
+		}
+		p.current = nil
+	}
+	speaker.Unlock()
+	if skipped {
+		p.history.skip()
+	}
+	t.control = &beep.Ctrl{Streamer: beep.Seq(t.fader, beep.Callback(func() {
+		t.streamer.Close()
+		log.WithFields(log.Fields{
+			"name": t.song.GetName(),
+		}).Debug("Finished a song")
+
+		if !t.finished {
+			t.finished = true
+			p.nextSong <- true
+		}
+	})), Paused: false}
+	speaker.Lock()
+	p.current = t
+	p.currentPlaylist = t.info.Playlist
+	p.nowPlaying = t.info
+	speaker.Unlock()
+	common.PlayMusic(t.control)
+
+	p.history.add(HistoryEntry{
+		Name:     t.song.GetName(),
+		Playlist: t.info.Playlist,
+		Artist:   t.info.Artist,
+		Title:    t.info.Title,
+		Started:  time.Now(),
+	})
 
 	common.EventFire(common.Event{
 		Origin: "music",
 		Type:   "playing",
 	})
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "history",
+	})
 
 	log.WithFields(log.Fields{
-		"name": s.GetName(),
+		"name": t.song.GetName(),
 	}).Info("Playing a song")
 }
 
+// fadeLen returns the number of samples over which the music is faded when
+// it is paused, resumed, stopped or skipped
+func (p *musicPlayer) fadeLen() int {
+	return p.rate.N(time.Duration(p.fade) * time.Millisecond)
+}
+
 func (p *musicPlayer) Play() {
-	if p.control != nil {
-		speaker.Lock()
-		p.control.Paused = false
-		speaker.Unlock()
-	} else {
+	speaker.Lock()
+	current := p.current
+	if current != nil {
+		current.fader.fadeResume(p.fadeLen())
+	}
+	speaker.Unlock()
+	if current == nil {
 		p.Next()
 	}
 
@@ -298,11 +725,11 @@ func (p *musicPlayer) Play() {
 }
 
 func (p *musicPlayer) Pause() {
-	if p.control != nil {
-		speaker.Lock()
-		p.control.Paused = true
-		speaker.Unlock()
+	speaker.Lock()
+	if p.current != nil {
+		p.current.fader.fadePause(p.fadeLen())
 	}
+	speaker.Unlock()
 
 	common.EventFire(common.Event{
 		Origin: "music",
@@ -312,43 +739,119 @@ func (p *musicPlayer) Pause() {
 }
 
 func (p *musicPlayer) Stop() {
-	if p.control != nil {
-		speaker.Lock()
-		p.control.Streamer = nil
-		p.control = nil
-		speaker.Unlock()
+	p.startLock.Lock()
+	speaker.Lock()
+	if p.current != nil {
+		p.current.finished = true
+		p.current.fader.fadeOut(p.fadeLen())
+		p.current = nil
 	}
+	speaker.Unlock()
+	p.startLock.Unlock()
 
 	log.Debug("Stopped music playback")
 }
 
 func (p *musicPlayer) NowPlaying() SongInfo {
+	speaker.Lock()
+	defer speaker.Unlock()
 	return p.nowPlaying
 }
 
-func (p *musicPlayer) updateChances() {
-	intensity := common.GetIntensity()
-	newChances := make([]int, len(p.chancesMin))
-	for i := range p.chancesMin {
-		y0 := float64(p.chancesMin[i])
-		y1 := float64(p.chancesMax[i])
-		x := float64(intensity)
-		newChances[i] = int(y0 + math.Round(x*(y1-y0)/100))
+// Position returns how far into the current song the playback is.
+func (p *musicPlayer) Position() time.Duration {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.current == nil {
+		return 0
 	}
-	p.chances = newChances
+	return p.current.format.SampleRate.D(p.current.streamer.Position())
 }
 
-func (p *musicPlayer) GetChance(name string) (int, error) {
-	p.updateChances()
-	for i, v := range p.keys {
-		if v == name {
-			if i > len(p.chances)-1 {
-				return 0, nil
-			}
-			return p.chances[i], nil
+// Duration returns the total length of the current song.
+func (p *musicPlayer) Duration() time.Duration {
+	speaker.Lock()
+	defer speaker.Unlock()
+	if p.current == nil {
+		return 0
+	}
+	return p.current.format.SampleRate.D(p.current.streamer.Len())
+}
+
+// Seek jumps to the given position in the current song.
+func (p *musicPlayer) Seek(position time.Duration) error {
+	speaker.Lock()
+	if p.current == nil {
+		speaker.Unlock()
+		return ErrNothingPlaying
+	}
+	pos := p.current.format.SampleRate.N(position)
+	if pos < 0 {
+		pos = 0
+	} else if pos >= p.current.streamer.Len() {
+		pos = p.current.streamer.Len() - 1
+	}
+	err := p.current.streamer.Seek(pos)
+	speaker.Unlock()
+	if err != nil {
+		return err
+	}
+
+	p.fireProgress()
+	log.WithFields(log.Fields{
+		"position": position,
+	}).Debug("Seeked in the current song")
+	return nil
+}
+
+// Progress is the payload of the periodic progress events
+type Progress struct {
+	Elapsed float64 `json:"elapsed"`
+	Total   float64 `json:"total"`
+}
+
+func (p *musicPlayer) fireProgress() {
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "progress",
+		Data: Progress{
+			Elapsed: p.Position().Seconds(),
+			Total:   p.Duration().Seconds(),
+		},
+	})
+}
+
+// progress periodically reports the playback position of the current song
+func (p *musicPlayer) progress() {
+	ticker := time.NewTicker(progressInterval)
+	for range ticker.C {
+		speaker.Lock()
+		playing := p.current != nil && !p.current.fader.isPaused()
+		speaker.Unlock()
+		if playing {
+			p.fireProgress()
 		}
 	}
-	return -1, ErrPlaylistNotFound
+}
+
+func (p *musicPlayer) History() []HistoryEntry {
+	return p.history.list()
+}
+
+func (p *musicPlayer) UpNext() SongInfo {
+	p.nextLock.Lock()
+	defer p.nextLock.Unlock()
+	if len(p.queue) > 0 {
+		req := p.queue[0]
+		if req.track != nil {
+			return req.track.info
+		}
+		return SongInfo{Title: req.song.GetName(), Playlist: req.playlist}
+	}
+	if p.upNext == nil {
+		return SongInfo{}
+	}
+	return p.upNext.info
 }
 
 func (p *musicPlayer) run() {
@@ -0,0 +1,322 @@
+package music
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dulli/deichwave/pkg/common"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+const testRate = beep.SampleRate(44100)
+
+// newTestPlayer creates a player with the default config that plays on a
+// null sink and keeps all of its files in a temporary directory
+func newTestPlayer(t *testing.T, configure func(cfg *common.Config)) *musicPlayer {
+	t.Helper()
+	var cfg common.Config
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatalf("could not read the default config: %v", err)
+	}
+	dir := t.TempDir()
+	cfg.Audio.Rate = int(testRate)
+	cfg.Music.Ext = []string{".wav"}
+	cfg.Music.History = filepath.Join(dir, "history.json")
+	cfg.Music.Loudness = filepath.Join(dir, "loudness.json")
+	cfg.Music.Analysis = filepath.Join(dir, "analysis.json")
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	if err := common.ResetSpeaker(); err != nil {
+		t.Fatalf("could not reset the speaker: %v", err)
+	}
+	if err := common.SetSink(common.NewNullSink()); err != nil {
+		t.Fatalf("could not set the sink: %v", err)
+	}
+	mp, err := NewPlayer("test", &cfg)
+	if err != nil {
+		t.Fatalf("could not create the player: %v", err)
+	}
+	t.Cleanup(func() {
+		common.ResetSpeaker()
+	})
+	return mp.(*musicPlayer)
+}
+
+// writeTestSong writes a quiet sine wave of the given length as a WAV file
+func writeTestSong(t *testing.T, path string, length time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("could not create the directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("could not create the song: %v", err)
+	}
+	defer file.Close()
+
+	pos := 0
+	sine := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			v := 0.1 * math.Sin(2*math.Pi*440*float64(pos)/float64(testRate))
+			samples[i] = [2]float64{v, v}
+			pos++
+		}
+		return len(samples), true
+	})
+	format := beep.Format{SampleRate: testRate, NumChannels: 2, Precision: 2}
+	if err := wav.Encode(file, beep.Take(testRate.N(length), sine), format); err != nil {
+		t.Fatalf("could not encode the song: %v", err)
+	}
+}
+
+func TestPlayerLoadsSong(t *testing.T) {
+	p := newTestPlayer(t, nil)
+	path := filepath.Join(t.TempDir(), "Party", "Artist - Title.wav")
+	writeTestSong(t, path, time.Second)
+
+	tr, err := p.load("Party", NewSong("Artist - Title", path))
+	if err != nil {
+		t.Fatalf("load() failed: %v", err)
+	}
+	defer tr.streamer.Close()
+	if tr.info.Name != "Artist - Title" || tr.info.Playlist != "Party" {
+		t.Errorf("load() info = %q in %q, want %q in %q", tr.info.Name, tr.info.Playlist, "Artist - Title", "Party")
+	}
+	if got, want := tr.streamer.Len(), testRate.N(time.Second); got != want {
+		t.Errorf("load() length = %d, want %d", got, want)
+	}
+	if got := p.energyDistance(tr.song); got != energyUnknownDistance {
+		t.Errorf("energyDistance() of an unanalyzed song = %v, want %v", got, energyUnknownDistance)
+	}
+	if p.energyWindow != 5 {
+		t.Errorf("energyWindow = %d, want the default of 5", p.energyWindow)
+	}
+}
+
+func TestPlayerConcurrentNext(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		writeTestSong(t, filepath.Join(root, "Party", name+".wav"), 200*time.Millisecond)
+	}
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	common.SetIntensity(50)
+	sink := common.GetSink().(*common.OfflineSink)
+
+	// Songs are skipped from several places at once while the sink keeps
+	// playing, which must neither race nor leave more than one song playing
+	done := make(chan bool)
+	go func() {
+		for idx := 0; idx < 20; idx++ {
+			sink.Advance(10 * time.Millisecond)
+		}
+		done <- true
+	}()
+	for idx := 0; idx < 8; idx++ {
+		go p.Next()
+		go p.GetChance("Party")
+	}
+	go p.Stop()
+	go p.NowPlaying()
+	<-done
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.History()) < 8 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(p.History()); got < 8 {
+		t.Fatalf("%d songs were started, want at least 8", got)
+	}
+	p.Stop()
+	if got := p.Position(); got != 0 {
+		t.Errorf("Position() after Stop() = %v, want 0", got)
+	}
+	if got := p.NowPlaying(); got.Playlist != "Party" {
+		t.Errorf("NowPlaying() = %q in %q, want a song of %q", got.Name, got.Playlist, "Party")
+	}
+}
+
+func TestPlayerSeek(t *testing.T) {
+	root := t.TempDir()
+	writeTestSong(t, filepath.Join(root, "Party", "a.wav"), time.Second)
+	p := newTestPlayer(t, nil)
+	if err := p.Seek(time.Second); err != ErrNothingPlaying {
+		t.Errorf("Seek() without a song = %v, want %v", err, ErrNothingPlaying)
+	}
+	if got := p.Position(); got != 0 {
+		t.Errorf("Position() without a song = %v, want 0", got)
+	}
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	p.Next()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Duration() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := p.Duration(); got != time.Second {
+		t.Fatalf("Duration() = %v, want %v", got, time.Second)
+	}
+
+	last := testRate.D(testRate.N(time.Second) - 1)
+	tests := []struct {
+		name     string
+		position time.Duration
+		want     time.Duration
+	}{
+		{"within the song", 500 * time.Millisecond, 500 * time.Millisecond},
+		{"back to the start", 0, 0},
+		{"before the start", -time.Second, 0},
+		{"past the end", 5 * time.Second, last},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Seek(tt.position); err != nil {
+				t.Fatalf("Seek(%v) failed: %v", tt.position, err)
+			}
+			if got := p.Position(); got != tt.want {
+				t.Errorf("Position() after Seek(%v) = %v, want %v", tt.position, got, tt.want)
+			}
+		})
+	}
+
+	// The position moves along with the sink
+	if err := p.Seek(100 * time.Millisecond); err != nil {
+		t.Fatalf("Seek() failed: %v", err)
+	}
+	common.GetSink().(*common.OfflineSink).Advance(200 * time.Millisecond)
+	if got := p.Position(); got < 300*time.Millisecond {
+		t.Errorf("Position() after playing = %v, want at least %v", got, 300*time.Millisecond)
+	}
+}
+
+var eventLoop sync.Once
+
+// startEventLoop runs the event loop for the remaining tests, as it can not
+// be stopped again
+func startEventLoop(t *testing.T) {
+	t.Helper()
+	eventLoop.Do(func() {
+		started := make(chan bool, 1)
+		common.EventListen(func(ev common.Event) {
+			if ev.Origin == "test" && ev.Type == "started" {
+				select {
+				case started <- true:
+				default:
+				}
+			}
+		})
+		go common.EventLoop()
+		for {
+			go common.EventFire(common.Event{Origin: "test", Type: "started"})
+			select {
+			case <-started:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+}
+
+// fireWithin fails the test if the event loop does not take an event in time
+func fireWithin(t *testing.T, ev common.Event, timeout time.Duration) {
+	t.Helper()
+	fired := make(chan bool)
+	go func() {
+		common.EventFire(ev)
+		close(fired)
+	}()
+	select {
+	case <-fired:
+	case <-time.After(timeout):
+		t.Fatalf("the event loop did not take the %s/%s event", ev.Origin, ev.Type)
+	}
+}
+
+func TestPlayerProfileChangesMode(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"c", "a", "b"} {
+		writeTestSong(t, filepath.Join(root, "Party", name+".wav"), 10*time.Millisecond)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "profiles"), 0755); err != nil {
+		t.Fatalf("could not create the profiles: %v", err)
+	}
+	profile := "[music.playlists.Party]\nmode = \"ordered\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "profiles", "ordered.toml"), []byte(profile), 0644); err != nil {
+		t.Fatalf("could not write the profile: %v", err)
+	}
+
+	var cfg *common.Config
+	p := newTestPlayer(t, func(c *common.Config) {
+		c.File = filepath.Join(dir, "config.toml")
+		cfg = c
+	})
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	startEventLoop(t)
+	switcher, err := common.NewProfilSwitcher(cfg)
+	if err != nil {
+		t.Fatalf("NewProfilSwitcher() failed: %v", err)
+	}
+
+	// The playlist announces its new order, which must neither happen inside
+	// the event loop nor while the player is locked
+	if err := switcher.SetProfile("ordered"); err != nil {
+		t.Fatalf("SetProfile() failed: %v", err)
+	}
+	fireWithin(t, common.Event{Origin: "test", Type: "ping"}, 2*time.Second)
+	pl, _ := p.GetPlaylist("Party")
+	deadline := time.Now().Add(2 * time.Second)
+	for pl.GetMode() != ModeOrdered && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := pl.GetMode(); got != ModeOrdered {
+		t.Fatalf("mode after changing the profile = %q, want %q", got, ModeOrdered)
+	}
+	if got, want := pl.ListSongs(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("songs after changing the profile = %v, want %v", got, want)
+	}
+}
+
+func TestPlayerNextFromListener(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		writeTestSong(t, filepath.Join(root, "Party", name+".wav"), 200*time.Millisecond)
+	}
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	startEventLoop(t)
+	for _, name := range []string{"a", "b"} {
+		if err := p.Enqueue("Party", name); err != nil {
+			t.Fatalf("Enqueue(%q) failed: %v", name, err)
+		}
+	}
+	common.EventListen(func(ev common.Event) {
+		if ev.Origin == "test" && ev.Type == "skip" {
+			p.Next()
+		}
+	})
+
+	// Skipping from a listener, e.g. a hook, must not block the event loop
+	fireWithin(t, common.Event{Origin: "test", Type: "skip"}, 2*time.Second)
+	fireWithin(t, common.Event{Origin: "test", Type: "ping"}, 2*time.Second)
+	queue := p.ListQueue()
+	if len(queue) != 1 || queue[0].Name != "b" {
+		t.Errorf("queue after skipping = %+v, want only b", queue)
+	}
+}
@@ -1,28 +1,59 @@
 package music
 
 import (
+	"errors"
 	"math/rand"
+	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/dulli/deichwave/pkg/common"
 	log "github.com/sirupsen/logrus"
 )
 
+// A playlist either shuffles its songs, plays them in order or loops a single
+// song until it is skipped
+const (
+	ModeShuffle = "shuffle"
+	ModeOrdered = "ordered"
+	ModeSingle  = "single"
+)
+
+var ErrPlaylistModeInvalid = errors.New("playlist mode has to be shuffle, ordered or single")
+
 type Playlist interface {
 	ListSongs() []string
+	GetSong(name string) (Song, error)
+	GetMode() string
 	Next() Song
 	Skip()
 	GetPosition() int
 	addSong(song Song)
+	songs() []Song
+	update(paths []string, index func(path string) Song) (int, int)
+	setMode(mode string)
 	shuffle()
 }
 
+// The position always points to the song that will be played next, but a
+// shuffled playlist may prefer another one of the songs that were not played
+// yet. Ordered playlists from files keep the order of the file, all others are
+// ordered by folder, track number and file name
 type playlist struct {
-	Name  string
-	Songs []Song
-	Pos   int
+	Name   string
+	Songs  []Song
+	Pos    int
+	Mode   string
+	file   bool
+	order  map[string]int
+	prefer func(upcoming []Song) int
+	events []string // Fired once the lock is released
+	lock   sync.Mutex
 }
 
 func (p *playlist) ListSongs() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	lists := make([]string, len(p.Songs))
 	for idx := range p.Songs {
 		lists[idx] = p.Songs[idx].GetName()
@@ -30,12 +61,46 @@ func (p *playlist) ListSongs() []string {
 	return lists
 }
 
+func (p *playlist) GetSong(name string) (Song, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, song := range p.Songs {
+		if song.GetName() == name {
+			return song, nil
+		}
+	}
+	return nil, ErrSongNotFound
+}
+
+func (p *playlist) GetMode() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.Mode
+}
+
 func (p *playlist) Next() Song {
+	p.lock.Lock()
+	defer p.unlock()
+	if len(p.Songs) == 0 {
+		return nil
+	}
+	if p.Mode == ModeSingle {
+		return p.Songs[p.Pos]
+	}
+	if p.Mode == ModeShuffle && p.prefer != nil {
+		if idx := p.Pos + p.prefer(p.Songs[p.Pos:]); idx > p.Pos && idx < len(p.Songs) {
+			p.Songs[p.Pos], p.Songs[idx] = p.Songs[idx], p.Songs[p.Pos]
+			p.notify("shuffle")
+		}
+	}
+	song := p.Songs[p.Pos]
 	p.incPos()
-	return p.Songs[p.Pos-1]
+	return song
 }
 
 func (p *playlist) Skip() {
+	p.lock.Lock()
+	defer p.unlock()
 	p.incPos()
 	log.WithFields(log.Fields{
 		"name": p.Name,
@@ -43,6 +108,8 @@ func (p *playlist) Skip() {
 }
 
 func (p *playlist) GetPosition() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	return p.Pos
 }
 
@@ -50,26 +117,163 @@ func (p *playlist) incPos() {
 	p.Pos += 1
 	if p.Pos >= len(p.Songs) {
 		p.Pos = 0
-		p.shuffle()
+		if p.Mode == ModeShuffle {
+			p.reorder()
+		}
 	}
-	common.EventFire(common.Event{
-		Origin: "music",
-		Name:   p.Name,
-		Type:   "position",
-	})
+	p.notify("position")
+}
+
+// notify collects an event of the playlist, so that it is only fired after
+// the lock is released. Must be called while holding the lock.
+func (p *playlist) notify(typ string) {
+	for _, pending := range p.events {
+		if pending == typ {
+			return
+		}
+	}
+	p.events = append(p.events, typ)
+}
+
+// unlock releases the lock of the playlist and fires the collected events
+func (p *playlist) unlock() {
+	events := p.events
+	p.events = nil
+	p.lock.Unlock()
+	for _, typ := range events {
+		common.EventFire(common.Event{
+			Origin: "music",
+			Name:   p.Name,
+			Type:   typ,
+		})
+	}
+}
+
+func (p *playlist) songs() []Song {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	songs := make([]Song, len(p.Songs))
+	copy(songs, p.Songs)
+	return songs
 }
 
 func (p *playlist) addSong(song Song) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.Songs = append(p.Songs, song)
 }
 
+// update removes all songs whose files are not part of the given paths and
+// adds the new ones at random positions among the songs that have not been
+// played yet, it returns how many songs were added and removed
+func (p *playlist) update(paths []string, index func(path string) Song) (int, int) {
+	p.lock.Lock()
+	defer p.unlock()
+
+	wanted := make(map[string]bool, len(paths))
+	p.order = make(map[string]int, len(paths))
+	for idx, path := range paths {
+		wanted[path] = true
+		p.order[path] = idx
+	}
+	known := make(map[string]bool, len(p.Songs))
+	removed := 0
+	songs := make([]Song, 0, len(p.Songs))
+	for idx, song := range p.Songs {
+		if wanted[song.getPath()] {
+			known[song.getPath()] = true
+			songs = append(songs, song)
+			continue
+		}
+		if idx < p.Pos {
+			p.Pos -= 1
+		}
+		removed += 1
+	}
+	p.Songs = songs
+
+	added := 0
+	for _, path := range paths {
+		if known[path] {
+			continue
+		}
+		pos := p.Pos + rand.Intn(len(p.Songs)-p.Pos+1)
+		p.Songs = append(p.Songs[:pos], append([]Song{index(path)}, p.Songs[pos:]...)...)
+		added += 1
+	}
+	if p.Pos >= len(p.Songs) {
+		p.Pos = 0
+	}
+	if p.Mode != ModeShuffle && (added > 0 || removed > 0) {
+		var upcoming Song
+		if p.Pos < len(p.Songs) {
+			upcoming = p.Songs[p.Pos]
+		}
+		p.arrange()
+		for idx, song := range p.Songs {
+			if song == upcoming {
+				p.Pos = idx
+			}
+		}
+	}
+	return added, removed
+}
+
+// setMode changes how the playlist is played and starts it over
+func (p *playlist) setMode(mode string) {
+	p.lock.Lock()
+	defer p.unlock()
+	if p.Mode == mode {
+		return
+	}
+	p.Mode = mode
+	p.Pos = 0
+	if mode == ModeShuffle {
+		p.reorder()
+	} else {
+		p.arrange()
+	}
+	log.WithFields(log.Fields{
+		"name": p.Name,
+		"mode": mode,
+	}).Debug("Changed the playlist mode")
+}
+
 func (p *playlist) shuffle() {
+	p.lock.Lock()
+	defer p.unlock()
+	p.reorder()
+}
+
+// arrange sorts the songs in the order of the playlist file, or by folder,
+// track number and file name, songs without a track number come last
+func (p *playlist) arrange() {
+	sort.SliceStable(p.Songs, func(i, j int) bool {
+		a, b := p.Songs[i], p.Songs[j]
+		if p.file {
+			return p.order[a.getPath()] < p.order[b.getPath()]
+		}
+		if da, db := filepath.Dir(a.getPath()), filepath.Dir(b.getPath()); da != db {
+			return da < db
+		}
+		if ta, tb := trackOrder(a), trackOrder(b); ta != tb {
+			return ta < tb
+		}
+		return a.getPath() < b.getPath()
+	})
+	p.notify("shuffle")
+}
+
+func trackOrder(s Song) int {
+	if s.GetTrack() == 0 {
+		return int(^uint(0) >> 1)
+	}
+	return s.GetTrack()
+}
+
+func (p *playlist) reorder() {
 	rand.Shuffle(len(p.Songs), func(i, j int) {
 		p.Songs[i], p.Songs[j] = p.Songs[j], p.Songs[i]
 	})
-	common.EventFire(common.Event{
-		Origin: "music",
-		Name:   p.Name,
-		Type:   "shuffle",
-	})
+	p.notify("shuffle")
 }
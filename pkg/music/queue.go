@@ -0,0 +1,143 @@
+package music
+
+import (
+	"errors"
+
+	"github.com/dulli/deichwave/pkg/common"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrQueueIndexInvalid = errors.New("queue position is out of range")
+
+// QueueEntry describes a song that has been requested to be played next
+type QueueEntry struct {
+	Playlist string
+	Name     string
+}
+
+// Requested songs are kept in a queue that is drained before the rng is used
+// to pick any further songs, the first one is decoded ahead of time
+type queueEntry struct {
+	playlist string
+	song     Song
+	track    *track
+}
+
+// Enqueue requests a song from a playlist to be played after all songs that
+// were requested before.
+func (p *musicPlayer) Enqueue(playlist string, name string) error {
+	pl, err := p.GetPlaylist(playlist)
+	if err != nil {
+		return err
+	}
+	s, err := pl.GetSong(name)
+	if err != nil {
+		return err
+	}
+
+	p.nextLock.Lock()
+	p.queue = append(p.queue, &queueEntry{playlist: playlist, song: s})
+	p.nextLock.Unlock()
+
+	p.queueChanged()
+	log.WithFields(log.Fields{
+		"list": playlist,
+		"name": name,
+	}).Info("Requested a song")
+	return nil
+}
+
+// ListQueue returns all requested songs in the order they will be played.
+func (p *musicPlayer) ListQueue() []QueueEntry {
+	p.nextLock.Lock()
+	defer p.nextLock.Unlock()
+	entries := make([]QueueEntry, len(p.queue))
+	for idx, req := range p.queue {
+		entries[idx] = QueueEntry{Playlist: req.playlist, Name: req.song.GetName()}
+	}
+	return entries
+}
+
+// MoveQueued moves the requested song at one position in the queue to another.
+func (p *musicPlayer) MoveQueued(from int, to int) error {
+	p.nextLock.Lock()
+	if from < 0 || from >= len(p.queue) || to < 0 || to >= len(p.queue) {
+		p.nextLock.Unlock()
+		return ErrQueueIndexInvalid
+	}
+	req := p.queue[from]
+	p.queue = append(p.queue[:from], p.queue[from+1:]...)
+	p.queue = append(p.queue[:to], append([]*queueEntry{req}, p.queue[to:]...)...)
+	p.nextLock.Unlock()
+
+	p.queueChanged()
+	return nil
+}
+
+// Dequeue removes the requested song at the given position from the queue.
+func (p *musicPlayer) Dequeue(index int) error {
+	p.nextLock.Lock()
+	if index < 0 || index >= len(p.queue) {
+		p.nextLock.Unlock()
+		return ErrQueueIndexInvalid
+	}
+	req := p.queue[index]
+	p.queue = append(p.queue[:index], p.queue[index+1:]...)
+	p.nextLock.Unlock()
+
+	if req.track != nil {
+		req.track.streamer.Close()
+	}
+	p.queueChanged()
+	return nil
+}
+
+// preloadRequest decodes the first requested song ahead of time
+func (p *musicPlayer) preloadRequest() {
+	p.nextLock.Lock()
+	if len(p.queue) == 0 || p.queue[0].track != nil {
+		p.nextLock.Unlock()
+		return
+	}
+	req := p.queue[0]
+	p.nextLock.Unlock()
+
+	t, err := p.load(req.playlist, req.song)
+	if err != nil {
+		return
+	}
+	p.normalizeTrack(t)
+
+	// The request might have been played or removed in the meantime
+	p.nextLock.Lock()
+	queued := false
+	for _, other := range p.queue {
+		if other == req {
+			queued = true
+		}
+	}
+	if !queued || req.track != nil {
+		p.nextLock.Unlock()
+		t.streamer.Close()
+		return
+	}
+	req.track = t
+	p.nextLock.Unlock()
+
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "upnext",
+	})
+}
+
+func (p *musicPlayer) queueChanged() {
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "queue",
+	})
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "upnext",
+	})
+	go p.preloadRequest()
+}
@@ -0,0 +1,116 @@
+package music
+
+import (
+	"path/filepath"
+
+	"github.com/dulli/deichwave/pkg/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rescan compares the music directory with the loaded playlists and adds or
+// removes playlists and songs accordingly, without interrupting playback.
+func (p *musicPlayer) Rescan() error {
+	p.scanLock.Lock()
+	defer p.scanLock.Unlock()
+	found, err := p.scan(p.root)
+	if err != nil {
+		return err
+	}
+
+	added, removed := p.apply(found)
+	p.covers.clear()
+	p.requestAnalysis()
+
+	log.WithFields(log.Fields{
+		"added":   added,
+		"removed": removed,
+	}).Info("Rescanned the music library")
+	common.EventFire(common.Event{
+		Origin: "music",
+		Type:   "rescan",
+	})
+	return nil
+}
+
+// LoadPlaylists scans the music directory and loads all playlists in it.
+func (p *musicPlayer) LoadPlaylists(root string) error {
+	p.scanLock.Lock()
+	defer p.scanLock.Unlock()
+	p.root = filepath.Clean(root)
+	found, err := p.scan(p.root)
+	p.apply(found)
+	p.requestAnalysis()
+	return err
+}
+
+// apply updates the playlists to the scanned music directory and returns how
+// many songs were added and removed. The tags of new songs are read and the
+// playlists are updated without holding the list lock, which is only taken to
+// swap in the result, so that the player keeps going during a large scan
+func (p *musicPlayer) apply(found map[string]*scannedPlaylist) (int, int) {
+	p.listLock.RLock()
+	lists := make(map[string]Playlist, len(found))
+	for name := range found {
+		if pl, ok := p.list[name]; ok {
+			lists[name] = pl
+		}
+	}
+	p.listLock.RUnlock()
+
+	added, removed := 0, 0
+	for name, scanned := range found {
+		pl, ok := lists[name]
+		if !ok {
+			pl = p.newPlaylist(name, scanned)
+			lists[name] = pl
+			log.WithFields(log.Fields{
+				"list": name,
+			}).Info("Added a playlist")
+		}
+		known := make(map[string]bool)
+		for _, s := range pl.songs() {
+			known[s.getPath()] = true
+		}
+		indexed := make(map[string]Song)
+		for _, path := range scanned.paths {
+			if !known[path] {
+				indexed[path] = p.indexSong(name, path)
+			}
+		}
+		a, r := pl.update(scanned.paths, func(path string) Song {
+			if s, ok := indexed[path]; ok {
+				return s
+			}
+			return p.indexSong(name, path)
+		})
+		added += a
+		removed += r
+	}
+
+	p.listLock.Lock()
+	for name, pl := range p.list {
+		if _, ok := found[name]; !ok {
+			removed += len(pl.ListSongs())
+			delete(p.list, name)
+			delete(p.markers, name)
+			log.WithFields(log.Fields{
+				"list": name,
+			}).Info("Removed a playlist")
+		}
+	}
+	modes := make(map[string]string, len(found))
+	for name, scanned := range found {
+		p.list[name] = lists[name]
+		p.markers[name] = scanned.marker
+		modes[name] = p.playlistMode(name)
+	}
+	p.sortKeys()
+	p.listLock.Unlock()
+
+	// Playlists fire events when their mode changes, so they are only changed
+	// once the lock is released
+	for name, pl := range lists {
+		pl.setMode(modes[name])
+	}
+	return added, removed
+}
@@ -0,0 +1,101 @@
+package music
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dulli/deichwave/pkg/common"
+)
+
+func TestScanMarkerFiles(t *testing.T) {
+	root := t.TempDir()
+	songs := map[string][]string{
+		"Ordered": {"b.wav", "a.wav", "c.wav"},
+		"Single":  {"x.wav"},
+		"Shuffle": {"y.wav", "z.wav"},
+	}
+	for list, names := range songs {
+		for _, name := range names {
+			writeTestSong(t, filepath.Join(root, list, name), 10*time.Millisecond)
+		}
+	}
+	for _, marker := range []string{"Ordered/.ordered", "Single/.single"} {
+		if err := os.WriteFile(filepath.Join(root, marker), nil, 0644); err != nil {
+			t.Fatalf("could not write the marker: %v", err)
+		}
+	}
+
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	modes := map[string]string{"Ordered": ModeOrdered, "Single": ModeSingle, "Shuffle": ModeShuffle}
+	for list, want := range modes {
+		pl, err := p.GetPlaylist(list)
+		if err != nil {
+			t.Fatalf("GetPlaylist(%q) failed: %v", list, err)
+		}
+		if got := pl.GetMode(); got != want {
+			t.Errorf("mode of %q = %q, want %q", list, got, want)
+		}
+	}
+	pl, _ := p.GetPlaylist("Ordered")
+	if got, want := pl.ListSongs(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ordered songs = %v, want %v", got, want)
+	}
+
+	// Markers are picked up and dropped again by a rescan
+	if err := os.Remove(filepath.Join(root, "Ordered", ".ordered")); err != nil {
+		t.Fatalf("could not remove the marker: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Shuffle", ".ordered"), nil, 0644); err != nil {
+		t.Fatalf("could not write the marker: %v", err)
+	}
+	if err := p.Rescan(); err != nil {
+		t.Fatalf("Rescan() failed: %v", err)
+	}
+	modes = map[string]string{"Ordered": ModeShuffle, "Single": ModeSingle, "Shuffle": ModeOrdered}
+	for list, want := range modes {
+		pl, _ := p.GetPlaylist(list)
+		if got := pl.GetMode(); got != want {
+			t.Errorf("mode of %q after the rescan = %q, want %q", list, got, want)
+		}
+	}
+}
+
+func TestRescanWithListener(t *testing.T) {
+	root := t.TempDir()
+	writeTestSong(t, filepath.Join(root, "Party", "a.wav"), 10*time.Millisecond)
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+	startEventLoop(t)
+	common.EventListen(func(ev common.Event) {
+		if ev.Origin == "music" {
+			p.ListPlaylists()
+		}
+	})
+
+	// Listeners that read the player must not be blocked by the rescan,
+	// which fires the events of the new playlist
+	writeTestSong(t, filepath.Join(root, "Chill", "b.wav"), 10*time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- p.Rescan()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Rescan() failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Rescan() did not return")
+	}
+	if got, want := p.ListPlaylists(), []string{"Chill", "Party"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("playlists after the rescan = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package music
+
+import (
+	"math"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// preferNext chooses the upcoming song of a playlist that is played next. Only
+// the first few songs are considered to keep the order of the playlist random,
+// songs that would repeat an artist or a title too soon are avoided and among
+// the rest the one whose energy matches the intensity best is chosen
+func (p *musicPlayer) preferNext(upcoming []Song) int {
+	window := p.energyWindow
+	if window < 1 {
+		window = 1
+	}
+	if window > len(upcoming) {
+		window = len(upcoming)
+	}
+
+	recent := p.recent()
+	candidates := make([]int, 0, window)
+	for idx := range upcoming[:window] {
+		if p.separated(upcoming[idx], recent) {
+			candidates = append(candidates, idx)
+		}
+	}
+	if len(candidates) == 0 {
+		for idx := window; idx < len(upcoming); idx++ {
+			if p.separated(upcoming[idx], recent) {
+				candidates = append(candidates, idx)
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		log.Debug("No upcoming song keeps the separation rules")
+		for idx := range upcoming[:window] {
+			candidates = append(candidates, idx)
+		}
+	}
+
+	best, bestDistance := 0, math.Inf(1)
+	for _, idx := range candidates {
+		if distance := p.energyDistance(upcoming[idx]); distance < bestDistance {
+			best, bestDistance = idx, distance
+		}
+	}
+	return best
+}
+
+// recent lists the songs that were played or requested most recently, starting
+// with the one that is played last
+func (p *musicPlayer) recent() []HistoryEntry {
+	p.nextLock.Lock()
+	entries := make([]HistoryEntry, 0, len(p.queue))
+	for idx := len(p.queue) - 1; idx >= 0; idx-- {
+		s := p.queue[idx].song
+		entries = append(entries, HistoryEntry{Name: s.GetName(), Artist: s.GetArtist(), Title: s.GetTitle()})
+	}
+	p.nextLock.Unlock()
+	return append(entries, p.history.list()...)
+}
+
+// separated checks whether there are enough other songs between a song and
+// the last song of the same artist, or with the same title
+func (p *musicPlayer) separated(s Song, recent []HistoryEntry) bool {
+	artist := normalizeTag(s.GetArtist())
+	title := normalizeTag(s.GetTitle())
+	for idx, entry := range recent {
+		if artist != "" && idx < p.artistSeparation && normalizeTag(entry.Artist) == artist {
+			log.WithFields(log.Fields{
+				"name":   s.GetName(),
+				"artist": s.GetArtist(),
+			}).Debug("Avoided repeating an artist")
+			return false
+		}
+		if title != "" && idx < p.titleSeparation && normalizeTag(entry.Title) == title {
+			log.WithFields(log.Fields{
+				"name":  s.GetName(),
+				"title": s.GetTitle(),
+			}).Debug("Avoided repeating a title")
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
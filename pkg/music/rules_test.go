@@ -0,0 +1,85 @@
+package music
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testSong(artist string, title string) Song {
+	s := NewSong(artist+" - "+title, "/nonexistent/"+artist+" - "+title+".wav")
+	s.(*song).setTags(artist, title, 0)
+	return s
+}
+
+// playedSongs lists songs in the order they were played, each with its own
+// title unless given
+func playedSongs(artists ...string) []HistoryEntry {
+	entries := make([]HistoryEntry, len(artists))
+	for idx, artist := range artists {
+		entries[idx] = HistoryEntry{Name: artist, Artist: artist, Title: fmt.Sprintf("Title %d", idx)}
+	}
+	return entries
+}
+
+func fillers(count int) []HistoryEntry {
+	artists := make([]string, count)
+	for idx := range artists {
+		artists[idx] = fmt.Sprintf("Filler %d", idx)
+	}
+	return playedSongs(artists...)
+}
+
+func TestPreferNextSeparation(t *testing.T) {
+	original := HistoryEntry{Name: "Original", Artist: "Original", Title: "Song"}
+	tests := []struct {
+		name     string
+		played   []HistoryEntry
+		upcoming []Song
+		want     int
+	}{
+		{
+			name:     "artist played last",
+			played:   playedSongs("ABBA"),
+			upcoming: []Song{testSong("ABBA", "Waterloo"), testSong("Queen", "Bohemian Rhapsody")},
+			want:     1,
+		},
+		{
+			name:     "artist played long enough ago",
+			played:   playedSongs("ABBA", "Queen", "Toto", "Europe"),
+			upcoming: []Song{testSong("abba ", "Waterloo"), testSong("Queen", "Bohemian Rhapsody")},
+			want:     0,
+		},
+		{
+			name:     "title played recently by another artist",
+			played:   append([]HistoryEntry{original}, fillers(10)...),
+			upcoming: []Song{testSong("Cover Band", "Song"), testSong("Queen", "Bohemian Rhapsody")},
+			want:     1,
+		},
+		{
+			name:     "title played long enough ago",
+			played:   append([]HistoryEntry{original}, fillers(30)...),
+			upcoming: []Song{testSong("Cover Band", "song"), testSong("Queen", "Bohemian Rhapsody")},
+			want:     0,
+		},
+		{
+			name:     "no song keeps the rules",
+			played:   playedSongs("Queen", "ABBA"),
+			upcoming: []Song{testSong("ABBA", "Waterloo"), testSong("Queen", "Bohemian Rhapsody")},
+			want:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlayer(t, nil)
+			if p.artistSeparation != 3 || p.titleSeparation != 30 {
+				t.Fatalf("separation = %d, %d, want the defaults of 3, 30", p.artistSeparation, p.titleSeparation)
+			}
+			for _, entry := range tt.played {
+				p.history.add(entry)
+			}
+			if got := p.preferNext(tt.upcoming); got != tt.want {
+				t.Errorf("preferNext() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package music
+
+import (
+	"sort"
+	"strings"
+)
+
+// SearchResult is a song that matched a search query, results with a higher
+// score are better matches
+type SearchResult struct {
+	Playlist string
+	Name     string
+	Artist   string
+	Title    string
+	Score    int
+}
+
+// Search looks for songs in all playlists whose file name, artist or title
+// match the query and returns them ordered by relevance.
+func (p *musicPlayer) Search(query string) []SearchResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+	results := make([]SearchResult, 0)
+	if query == "" {
+		return results
+	}
+
+	tokens := strings.Fields(query)
+	p.listLock.RLock()
+	defer p.listLock.RUnlock()
+	for _, key := range p.keys {
+		for _, s := range p.list[key].songs() {
+			score := rank(query, tokens, s.GetName(), s.GetArtist(), s.GetTitle())
+			if score == 0 {
+				continue
+			}
+			results = append(results, SearchResult{
+				Playlist: key,
+				Name:     s.GetName(),
+				Artist:   s.GetArtist(),
+				Title:    s.GetTitle(),
+				Score:    score,
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// rank scores how well the fields of a song match the query, every token of
+// the query has to be found in at least one field for the song to match
+func rank(query string, tokens []string, fields ...string) int {
+	score := 0
+	fields = append([]string{}, fields...)
+	for idx := range fields {
+		fields[idx] = strings.ToLower(fields[idx])
+		switch {
+		case fields[idx] == "":
+		case fields[idx] == query:
+			score += 100
+		case strings.HasPrefix(fields[idx], query):
+			score += 50
+		case strings.Contains(fields[idx], query):
+			score += 25
+		}
+	}
+
+	for _, token := range tokens {
+		found := false
+		for _, field := range fields {
+			if strings.Contains(field, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+		score += 5
+	}
+	return score
+}
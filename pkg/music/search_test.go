@@ -0,0 +1,76 @@
+package music
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		fields []string
+		want   int
+	}{
+		{"exact match", "abba", []string{"ABBA - Waterloo", "ABBA", "Waterloo"}, 100 + 50 + 5},
+		{"prefix match", "water", []string{"ABBA - Waterloo", "ABBA", "Waterloo"}, 25 + 50 + 5},
+		{"substring match", "loo", []string{"ABBA - Waterloo", "ABBA", "Waterloo"}, 25 + 25 + 5},
+		{"tokens in different fields", "abba waterloo", []string{"Waterloo", "ABBA", "Waterloo"}, 10},
+		{"missing token", "abba queen", []string{"ABBA - Waterloo", "ABBA", "Waterloo"}, 0},
+		{"no match", "queen", []string{"ABBA - Waterloo", "ABBA", "Waterloo"}, 0},
+		{"empty fields", "abba", []string{"ABBA", "", ""}, 100 + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := append([]string{}, tt.fields...)
+			if got := rank(tt.query, strings.Fields(tt.query), fields...); got != tt.want {
+				t.Errorf("rank(%q, %q) = %d, want %d", tt.query, tt.fields, got, tt.want)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("rank() changed the fields to %q", fields)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	root := t.TempDir()
+	songs := map[string][]string{
+		"Party": {"Waterloo", "Dancing Queen"},
+		"Chill": {"Water", "Sunrise"},
+	}
+	for list, names := range songs {
+		for _, name := range names {
+			writeTestSong(t, filepath.Join(root, list, name+".wav"), 10*time.Millisecond)
+		}
+	}
+	p := newTestPlayer(t, nil)
+	if err := p.LoadPlaylists(root); err != nil {
+		t.Fatalf("LoadPlaylists() failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"water", []string{"Water", "Waterloo"}},
+		{"  QUEEN ", []string{"Dancing Queen"}},
+		{"dancing sunrise", []string{}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results := p.Search(tt.query)
+			got := make([]string, len(results))
+			for idx, result := range results {
+				got[idx] = result.Name
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,19 @@ package music
 
 type Song interface {
 	GetName() string
+	GetArtist() string
+	GetTitle() string
+	GetTrack() int
 	getPath() string
+	setTags(artist string, title string, track int)
 }
 
 type song struct {
-	Name string
-	path string
+	Name   string
+	Artist string
+	Title  string
+	Track  int
+	path   string
 }
 
 func NewSong(name string, path string) Song {
@@ -18,15 +25,42 @@ func (s *song) GetName() string {
 	return s.Name
 }
 
+func (s *song) GetArtist() string {
+	return s.Artist
+}
+
+func (s *song) GetTitle() string {
+	return s.Title
+}
+
+func (s *song) GetTrack() int {
+	return s.Track
+}
+
 func (s *song) getPath() string {
 	return s.path
 }
 
+func (s *song) setTags(artist string, title string, track int) {
+	s.Artist = artist
+	s.Title = title
+	s.Track = track
+}
+
 type SongInfo struct {
+	Name     string
 	Artist   string
 	Title    string
 	Playlist string
+	Track    int
 	Picture  SongPicture
+	Cover    string // ETag of the cover, empty if the song has none
+	Lyrics   Lyrics
+	Gain     float64 // [dB] Track gain needed to normalize the loudness
+	HasGain  bool
+	BPM      float64 // [BPM] Estimated tempo, 0 if the song was not analyzed yet
+	Energy   float64 // [%] Energy compared to all other songs
+	path     string
 }
 
 type SongPicture struct {
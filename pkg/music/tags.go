@@ -1,8 +1,13 @@
 package music
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	b64 "encoding/base64"
@@ -15,6 +20,64 @@ import (
 
 // Metadata block body type.
 const FLACPicture = 6
+const wavListMax = 1 << 20 // [B] Largest LIST chunk of a WAV file that is read
+
+var ErrTagsInvalid = errors.New("media file has an invalid header")
+
+// readTags gathers the meta data of a song according to its file type
+func readTags(path string) (SongInfo, error) {
+	switch filepath.Ext(path) {
+	case ".mp3":
+		return tags_mp3(path)
+	case ".ogg":
+		return tags_ogg(path)
+	case ".flac":
+		return tags_flac(path)
+	case ".wav":
+		return tags_wav(path)
+	}
+	return SongInfo{}, nil
+}
+
+// gainFromTags reads the track gain from ReplayGain or R128 tags, the keys of
+// the tags are expected to be lower case
+func gainFromTags(tags map[string]string) (float64, bool) {
+	if val, ok := tags["replaygain_track_gain"]; ok {
+		val = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(val)), "db")
+		gain, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err == nil {
+			return gain, true
+		}
+	}
+	if val, ok := tags["r128_track_gain"]; ok {
+		// R128 gains are stored as Q7.8 numbers relative to -23 LUFS, while
+		// ReplayGain uses -18 LUFS as its reference
+		q, err := strconv.Atoi(strings.TrimSpace(val))
+		if err == nil {
+			return float64(q)/256 + (loudnessReference - r128Reference), true
+		}
+	}
+	return 0, false
+}
+
+// lyricsFromTags reads the lyrics from Vorbis comments, which may contain
+// synced lyrics in the LRC format
+func lyricsFromTags(tags map[string]string) Lyrics {
+	if val, ok := tags["lyrics"]; ok {
+		return parseLRC(val)
+	}
+	return parseLRC(tags["unsyncedlyrics"])
+}
+
+// trackNumber parses track numbers like "3" or "3/12"
+func trackNumber(val string) int {
+	val = strings.TrimSpace(strings.SplitN(val, "/", 2)[0])
+	track, err := strconv.Atoi(val)
+	if err != nil || track < 0 {
+		return 0
+	}
+	return track
+}
 
 func tags_mp3(path string) (SongInfo, error) {
 	// Load id3 tags of currently playing song
@@ -28,9 +91,40 @@ func tags_mp3(path string) (SongInfo, error) {
 		Artist:   tag.Artist(),
 		Title:    tag.Title(),
 		Playlist: "",
+		Track:    trackNumber(tag.GetTextFrame(tag.CommonID("Track number/Position in set")).Text),
+	}
+
+	// ReplayGain values are stored in user defined text frames
+	userTags := make(map[string]string)
+	for _, frame := range tag.GetFrames("TXXX") {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok {
+			userTags[strings.ToLower(udtf.Description)] = udtf.Value
+		}
+	}
+	sI.Gain, sI.HasGain = gainFromTags(userTags)
+
+	// Synchronised lyrics are preferred over the plain ones
+	for _, frame := range tag.GetFrames("SYLT") {
+		if uf, ok := frame.(id3v2.UnknownFrame); ok {
+			if lyrics, ok := parseSYLT(uf.Body); ok {
+				sI.Lyrics = lyrics
+				break
+			}
+		}
+	}
+	if len(sI.Lyrics.Lines) == 0 {
+		for _, frame := range tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription")) {
+			if uslf, ok := frame.(id3v2.UnsynchronisedLyricsFrame); ok {
+				sI.Lyrics = parseLRC(uslf.Lyrics)
+				break
+			}
+		}
 	}
 
 	pictures := tag.GetFrames(tag.CommonID("Attached picture"))
+	if len(pictures) == 0 {
+		return sI, nil
+	}
 	pic, ok := pictures[0].(id3v2.PictureFrame)
 	if ok {
 		sI.Picture = SongPicture{
@@ -49,6 +143,7 @@ func tags_ogg(path string) (SongInfo, error) {
 	if err != nil {
 		return SongInfo{}, err
 	}
+	defer in.Close()
 	com, err := oggvorbis.GetCommentHeader(in)
 	if err != nil {
 		return SongInfo{}, err
@@ -58,7 +153,10 @@ func tags_ogg(path string) (SongInfo, error) {
 	tags := make(map[string]string)
 	for _, val := range com.Comments {
 		parts := strings.SplitN(val, "=", 2)
-		key := parts[0]
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(parts[0])
 		tag := parts[1]
 		tags[key] = tag
 	}
@@ -67,9 +165,15 @@ func tags_ogg(path string) (SongInfo, error) {
 		Artist:   tags["artist"],
 		Title:    tags["title"],
 		Playlist: "",
+		Track:    trackNumber(tags["tracknumber"]),
+		Lyrics:   lyricsFromTags(tags),
 	}
+	sI.Gain, sI.HasGain = gainFromTags(tags)
 
 	// Retrieve cover art
+	if _, ok := tags["metadata_block_picture"]; !ok {
+		return sI, nil
+	}
 	data, err := b64.StdEncoding.DecodeString(tags["metadata_block_picture"])
 	if err != nil {
 		return sI, err
@@ -106,3 +210,129 @@ func tags_ogg(path string) (SongInfo, error) {
 	}
 	return sI, nil
 }
+
+func tags_flac(path string) (SongInfo, error) {
+	// Load vorbis comments and pictures from the metadata blocks of the song
+	in, err := os.Open(path)
+	if err != nil {
+		return SongInfo{}, err
+	}
+	defer in.Close()
+	r := bufio.NewReader(in)
+
+	signature := make([]byte, 4)
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return SongInfo{}, err
+	}
+	if string(signature) != "fLaC" {
+		return SongInfo{}, ErrTagsInvalid
+	}
+
+	sI := SongInfo{
+		Playlist: "",
+	}
+	tags := make(map[string]string)
+	for {
+		block, err := meta.Parse(r)
+		if errors.Is(err, meta.ErrReservedType) {
+			err = block.Skip()
+		}
+		if err != nil {
+			return sI, err
+		}
+
+		switch body := block.Body.(type) {
+		case *meta.VorbisComment:
+			for _, tag := range body.Tags {
+				tags[strings.ToLower(tag[0])] = tag[1]
+			}
+			sI.Artist = tags["artist"]
+			sI.Title = tags["title"]
+			sI.Track = trackNumber(tags["tracknumber"])
+			sI.Gain, sI.HasGain = gainFromTags(tags)
+			sI.Lyrics = lyricsFromTags(tags)
+		case *meta.Picture:
+			// Prefer the front cover if there are multiple pictures
+			if sI.Picture.Data == nil || body.Type == 3 {
+				sI.Picture = SongPicture{
+					Data: body.Data,
+					Mime: body.MIME,
+				}
+			}
+		}
+		if block.IsLast {
+			return sI, nil
+		}
+	}
+}
+
+func tags_wav(path string) (SongInfo, error) {
+	// Load the RIFF info chunk of the song
+	in, err := os.Open(path)
+	if err != nil {
+		return SongInfo{}, err
+	}
+	defer in.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return SongInfo{}, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return SongInfo{}, ErrTagsInvalid
+	}
+
+	sI := SongInfo{
+		Playlist: "",
+	}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(in, chunk); err != nil {
+			// Reaching the end of the file without an info chunk is no error
+			if err == io.EOF {
+				return sI, nil
+			}
+			return sI, err
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		size += size % 2
+
+		// Skip the audio data without reading it, as well as lists that are
+		// too large to only hold tags, as the size comes from the file itself
+		if id != "LIST" || size > wavListMax {
+			if _, err := in.Seek(size, io.SeekCurrent); err != nil {
+				return sI, err
+			}
+			continue
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return sI, err
+		}
+		// Other lists, or ones too short to even name their type, are skipped
+		if len(data) < 4 || string(data[0:4]) != "INFO" {
+			continue
+		}
+		for pos := 4; pos+8 <= len(data); {
+			key := string(data[pos : pos+4])
+			length := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+			end := pos + 8 + length
+			if end > len(data) {
+				break
+			}
+			value := strings.TrimRight(string(data[pos+8:end]), "\x00")
+			switch key {
+			case "IART":
+				sI.Artist = value
+			case "INAM":
+				sI.Title = value
+			case "ITRK", "IPRT":
+				sI.Track = trackNumber(value)
+			}
+			pos = end + length%2
+		}
+		return sI, nil
+	}
+}
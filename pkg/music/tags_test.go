@@ -0,0 +1,61 @@
+package music
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// riffChunk encodes a chunk of a RIFF file, padded to an even length
+func riffChunk(id string, data []byte) []byte {
+	chunk := make([]byte, 8, 8+len(data)+1)
+	copy(chunk, id)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestTagsWAV(t *testing.T) {
+	info := []byte("INFO")
+	info = append(info, riffChunk("IART", []byte("ABBA\x00"))...)
+	info = append(info, riffChunk("INAM", []byte("Waterloo\x00"))...)
+	info = append(info, riffChunk("ITRK", []byte("3/12\x00"))...)
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   SongInfo
+	}{
+		{"info list", [][]byte{riffChunk("data", make([]byte, 16)), riffChunk("LIST", info)}, SongInfo{Artist: "ABBA", Title: "Waterloo", Track: 3}},
+		{"no list", [][]byte{riffChunk("data", make([]byte, 16))}, SongInfo{}},
+		{"other list", [][]byte{riffChunk("LIST", []byte("adtlxxxx"))}, SongInfo{}},
+		{"truncated list", [][]byte{riffChunk("LIST", []byte("IN")), riffChunk("LIST", info)}, SongInfo{Artist: "ABBA", Title: "Waterloo", Track: 3}},
+		{"empty list", [][]byte{riffChunk("LIST", nil)}, SongInfo{}},
+		{"oversized list", [][]byte{riffChunk("LIST", append([]byte("INFO"), make([]byte, wavListMax)...)), riffChunk("LIST", info)}, SongInfo{Artist: "ABBA", Title: "Waterloo", Track: 3}},
+		{"corrupt list size", [][]byte{{'L', 'I', 'S', 'T', 0xf0, 0xff, 0xff, 0xff}, info}, SongInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte("WAVE")
+			for _, chunk := range tt.chunks {
+				body = append(body, chunk...)
+			}
+			path := filepath.Join(t.TempDir(), "song.wav")
+			if err := os.WriteFile(path, riffChunk("RIFF", body), 0644); err != nil {
+				t.Fatalf("could not write the song: %v", err)
+			}
+
+			got, err := tags_wav(path)
+			if err != nil {
+				t.Fatalf("tags_wav() failed: %v", err)
+			}
+			if got.Artist != tt.want.Artist || got.Title != tt.want.Title || got.Track != tt.want.Track {
+				t.Errorf("tags_wav() = %q, %q, %d, want %q, %q, %d", got.Artist, got.Title, got.Track, tt.want.Artist, tt.want.Title, tt.want.Track)
+			}
+		})
+	}
+}
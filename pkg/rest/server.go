@@ -4,16 +4,18 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dulli/deichwave/pkg/common"
@@ -210,26 +212,255 @@ func (s Server) GetMusic(w http.ResponseWriter, r *http.Request) {
 // Get now playing info
 // (GET /music/playing)
 func (s Server) GetMusicPlaying(w http.ResponseWriter, r *http.Request) {
-	np := s.music.NowPlaying()
-
-	var dataURL string
-	if np.Picture.Data != nil {
-		dataURL = fmt.Sprintf(
-			"data:%s;base64,%s",
-			np.Picture.Mime,
-			base64.StdEncoding.EncodeToString(np.Picture.Data),
-		)
-	} else {
-		dataURL = ""
+	data := songInfo(s.music.NowPlaying())
+	elapsed := float32(s.music.Position().Seconds())
+	total := float32(s.music.Duration().Seconds())
+	data.Elapsed = &elapsed
+	data.Total = &total
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// Get now playing cover
+// (GET /music/playing/cover)
+func (s Server) GetMusicPlayingCover(w http.ResponseWriter, r *http.Request, params GetMusicPlayingCoverParams) {
+	cover, err := s.music.PlayingCover(coverSize(params.Size))
+	if errors.Is(err, music.ErrNothingPlaying) || errors.Is(err, music.ErrCoverNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
 	}
+	writeCover(w, r, cover, "no-cache")
+}
+
+func coverSize(size *int) int {
+	if size == nil {
+		return 0
+	}
+	return *size
+}
 
+// writeCover serves a cover image, answering conditional requests using its
+// ETag
+func writeCover(w http.ResponseWriter, r *http.Request, cover music.Cover, cacheControl string) {
+	w.Header().Set("Content-Type", cover.Mime)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", cover.ETag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(cover.Data))
+}
+
+// Get now playing lyrics
+// (GET /music/playing/lyrics)
+func (s Server) GetMusicPlayingLyrics(w http.ResponseWriter, r *http.Request) {
+	lyrics, err := s.music.PlayingLyrics()
+	if errors.Is(err, music.ErrNothingPlaying) || errors.Is(err, music.ErrLyricsNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, SongInfo{
+	render.JSON(w, r, lyricsData(lyrics))
+}
+
+func lyricsData(lyrics music.Lyrics) Lyrics {
+	data := Lyrics{
+		Synced: lyrics.Synced,
+		Lines:  make([]LyricsLineModel, len(lyrics.Lines)),
+	}
+	for idx, line := range lyrics.Lines {
+		data.Lines[idx] = LyricsLineModel{
+			Time: float32(line.Time.Seconds()),
+			Text: line.Text,
+		}
+	}
+	return data
+}
+
+// Seek in the current song
+// (POST /music/seek)
+func (s Server) PostMusicSeek(w http.ResponseWriter, r *http.Request) {
+	var seek PostMusicSeekJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&seek); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+	err := s.music.Seek(time.Duration(float64(seek.Position) * float64(time.Second)))
+	if errors.Is(err, music.ErrNothingPlaying) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Get up next info
+// (GET /music/next)
+func (s Server) GetMusicNext(w http.ResponseWriter, r *http.Request) {
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, songInfo(s.music.UpNext()))
+}
+
+// Get chance table
+// (GET /music/chances)
+func (s Server) GetMusicChances(w http.ResponseWriter, r *http.Request) {
+	table := s.music.ChanceTable()
+	data := ChanceTable{
+		Table: make([]PlaylistChancesModel, len(table)),
+	}
+	for idx, entry := range table {
+		probabilities := make([]float32, len(entry.Probabilities))
+		for i, probability := range entry.Probabilities {
+			probabilities[i] = float32(probability)
+		}
+		data.Table[idx] = PlaylistChancesModel{
+			Playlist:      entry.Playlist,
+			Chances:       entry.Chances,
+			Probabilities: probabilities,
+		}
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// Get play history
+// (GET /music/history)
+func (s Server) GetMusicHistory(w http.ResponseWriter, r *http.Request) {
+	entries := s.music.History()
+	data := SongHistory{
+		History: make([]SongHistoryEntryModel, len(entries)),
+	}
+	for idx, entry := range entries {
+		data.History[idx] = SongHistoryEntryModel{
+			Name:     &entry.Name,
+			Playlist: &entry.Playlist,
+			Artist:   &entry.Artist,
+			Title:    &entry.Title,
+			Started:  &entry.Started,
+			Skipped:  &entry.Skipped,
+		}
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// Search songs
+// (GET /music/search)
+func (s Server) GetMusicSearch(w http.ResponseWriter, r *http.Request, params GetMusicSearchParams) {
+	results := s.music.Search(params.Q)
+	data := SongSearch{
+		Results: make([]SongSearchResultModel, len(results)),
+	}
+	for idx, result := range results {
+		data.Results[idx] = SongSearchResultModel{
+			Playlist: result.Playlist,
+			Name:     result.Name,
+			Artist:   result.Artist,
+			Title:    result.Title,
+			Score:    result.Score,
+		}
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// List requested songs
+// (GET /music/queue)
+func (s Server) GetMusicQueue(w http.ResponseWriter, r *http.Request) {
+	entries := s.music.ListQueue()
+	data := SongQueue{
+		Queue: make([]QueueEntryModel, len(entries)),
+	}
+	for idx, entry := range entries {
+		data.Queue[idx] = QueueEntryModel{
+			Playlist: entry.Playlist,
+			Name:     entry.Name,
+		}
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// Request a song
+// (POST /music/queue)
+func (s Server) PostMusicQueue(w http.ResponseWriter, r *http.Request) {
+	var entry PostMusicQueueJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+	err := s.music.Enqueue(entry.Playlist, entry.Name)
+	if errors.Is(err, music.ErrPlaylistNotFound) || errors.Is(err, music.ErrSongNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Remove a requested song
+// (DELETE /music/queue/{index})
+func (s Server) DeleteMusicQueueIndex(w http.ResponseWriter, r *http.Request, index QueueIndex) {
+	err := s.music.Dequeue(index)
+	if errors.Is(err, music.ErrQueueIndexInvalid) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Move a requested song
+// (POST /music/queue/{index}/move/{position})
+func (s Server) PostMusicQueueIndexMove(w http.ResponseWriter, r *http.Request, index QueueIndex, position int) {
+	err := s.music.MoveQueued(index, position)
+	if errors.Is(err, music.ErrQueueIndexInvalid) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+func songInfo(np music.SongInfo) SongInfo {
+	// The cover is linked instead of embedded, the version changes the link
+	// whenever the cover changes so that browsers can cache it
+	var cover string
+	if np.Cover != "" {
+		cover = fmt.Sprintf(
+			"music/%s/%s/cover?v=%s",
+			url.PathEscape(np.Playlist),
+			url.PathEscape(np.Name),
+			strings.Trim(np.Cover, `"`),
+		)
+	}
+
+	info := SongInfo{
 		Artist:   &np.Artist,
 		Title:    &np.Title,
 		Playlist: np.Playlist,
-		Image:    &dataURL,
-	})
+		Cover:    &cover,
+	}
+	if np.BPM > 0 {
+		bpm := float32(np.BPM)
+		energy := float32(np.Energy)
+		info.Bpm = &bpm
+		info.Energy = &energy
+	}
+	return info
 }
 
 // Get playlist details
@@ -243,8 +474,10 @@ func (s Server) GetMusicPlaylist(w http.ResponseWriter, r *http.Request, playlis
 	}
 
 	songList := pl.ListSongs()
-	data := EntityList{
+	mode := pl.GetMode()
+	data := PlaylistDetails{
 		Entity: &songList,
+		Mode:   &mode,
 	}
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, data)
@@ -284,6 +517,56 @@ func (s Server) GetMusicPlaylistChance(w http.ResponseWriter, r *http.Request, p
 	render.JSON(w, r, data)
 }
 
+// Export playlist
+// (GET /music/{playlist}/m3u)
+func (s Server) GetMusicPlaylistM3u(w http.ResponseWriter, r *http.Request, playlist Playlist) {
+	if _, err := s.music.GetPlaylist(string(playlist)); errors.Is(err, music.ErrPlaylistNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", string(playlist)+".m3u8"))
+	w.WriteHeader(http.StatusOK)
+	err := s.music.ExportPlaylist(string(playlist), w)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"list": playlist,
+			"err":  err,
+		}).Error("Could not export a playlist")
+	}
+}
+
+// Get song cover
+// (GET /music/{playlist}/{song}/cover)
+func (s Server) GetMusicPlaylistSongCover(w http.ResponseWriter, r *http.Request, playlist Playlist, song Song, params GetMusicPlaylistSongCoverParams) {
+	cover, err := s.music.Cover(string(playlist), string(song), coverSize(params.Size))
+	if errors.Is(err, music.ErrPlaylistNotFound) || errors.Is(err, music.ErrSongNotFound) || errors.Is(err, music.ErrCoverNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	writeCover(w, r, cover, "public, max-age=86400")
+}
+
+// Get song lyrics
+// (GET /music/{playlist}/{song}/lyrics)
+func (s Server) GetMusicPlaylistSongLyrics(w http.ResponseWriter, r *http.Request, playlist Playlist, song Song) {
+	lyrics, err := s.music.Lyrics(string(playlist), string(song))
+	if errors.Is(err, music.ErrPlaylistNotFound) || errors.Is(err, music.ErrSongNotFound) || errors.Is(err, music.ErrLyricsNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, lyricsData(lyrics))
+}
+
 // Skip the next song in a playlist
 // (POST /music/{playlist}/skip)
 func (s Server) PostMusicPlaylistSkip(w http.ResponseWriter, r *http.Request, playlist Playlist) {
@@ -331,6 +614,18 @@ func (s Server) PostMusicNext(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, "OK")
 }
 
+// Rescan the music library
+// (POST /music/rescan)
+func (s Server) PostMusicRescan(w http.ResponseWriter, r *http.Request) {
+	if err := s.music.Rescan(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
 // List all sounds
 // (GET /sounds)
 func (s Server) GetSounds(w http.ResponseWriter, r *http.Request) {
@@ -342,6 +637,18 @@ func (s Server) GetSounds(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, data)
 }
 
+// Rescan the sounds
+// (POST /sounds/rescan)
+func (s Server) PostSoundsRescan(w http.ResponseWriter, r *http.Request) {
+	if err := s.sounds.Rescan(); err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
 // Get sound details
 // (GET /sounds/{sound})
 func (s Server) GetSoundsSound(w http.ResponseWriter, r *http.Request, sound Sound) {
@@ -385,6 +692,58 @@ func (s Server) PostSoundsPlay(w http.ResponseWriter, r *http.Request, sound Sou
 	render.JSON(w, r, "OK")
 }
 
+// Get sound volume
+// (GET /sounds/{sound}/volume)
+func (s Server) GetSoundsVolume(w http.ResponseWriter, r *http.Request, sound Sound) {
+	snd, err := s.sounds.GetSound(string(sound))
+	if errors.Is(err, sounds.ErrSoundNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, AudioLevelModel{
+		Level: snd.GetVolume(),
+	})
+}
+
+// Set sound volume
+// (POST /sounds/{sound}/volume)
+func (s Server) PostSoundsVolume(w http.ResponseWriter, r *http.Request, sound Sound) {
+	snd, err := s.sounds.GetSound(string(sound))
+	if errors.Is(err, sounds.ErrSoundNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	var vol PostSoundsVolumeJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&vol); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+
+	snd.SetVolume(vol.Level)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Change sound volume
+// (POST /sounds/{sound}/volume/{delta})
+func (s Server) PostSoundsVolumeDelta(w http.ResponseWriter, r *http.Request, sound Sound, delta int) {
+	snd, err := s.sounds.GetSound(string(sound))
+	if errors.Is(err, sounds.ErrSoundNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	}
+
+	snd.ChangeVolume(delta)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
 // Loop a sound
 // (POST /sounds/{sound}/loop)
 func (s Server) PostSoundsLoop(w http.ResponseWriter, r *http.Request, sound Sound) {
@@ -521,6 +880,192 @@ func (s Server) PostSystemVolumeDelta(w http.ResponseWriter, r *http.Request, de
 	render.JSON(w, r, "OK")
 }
 
+// Get music volume
+// (GET /system/volume/music)
+func (s Server) GetSystemVolumeMusic(w http.ResponseWriter, r *http.Request) {
+	volume, _ := common.GetChannelVolume(common.ChannelMusic)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, AudioLevelModel{
+		Level: volume,
+	})
+}
+
+// Set music volume
+// (POST /system/volume/music)
+func (s Server) PostSystemVolumeMusic(w http.ResponseWriter, r *http.Request) {
+	var vol PostSystemVolumeMusicJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&vol); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+	common.SetChannelVolume(common.ChannelMusic, vol.Level)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Change music volume
+// (POST /system/volume/music/{delta})
+func (s Server) PostSystemVolumeMusicDelta(w http.ResponseWriter, r *http.Request, delta int) {
+	common.ChangeChannelVolume(common.ChannelMusic, delta)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Get sounds volume
+// (GET /system/volume/sounds)
+func (s Server) GetSystemVolumeSounds(w http.ResponseWriter, r *http.Request) {
+	volume, _ := common.GetChannelVolume(common.ChannelSounds)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, AudioLevelModel{
+		Level: volume,
+	})
+}
+
+// Set sounds volume
+// (POST /system/volume/sounds)
+func (s Server) PostSystemVolumeSounds(w http.ResponseWriter, r *http.Request) {
+	var vol PostSystemVolumeSoundsJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&vol); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+	common.SetChannelVolume(common.ChannelSounds, vol.Level)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Change sounds volume
+// (POST /system/volume/sounds/{delta})
+func (s Server) PostSystemVolumeSoundsDelta(w http.ResponseWriter, r *http.Request, delta int) {
+	common.ChangeChannelVolume(common.ChannelSounds, delta)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Get audio devices
+// (GET /system/device)
+func (s Server) GetSystemDevice(w http.ResponseWriter, r *http.Request) {
+	devices, err := common.ListDevices()
+	if errors.Is(err, common.ErrDevicesUnsupported) {
+		render.Status(r, http.StatusNotImplemented)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	data := AudioDevices{
+		Devices:  make([]AudioDeviceModel, len(devices)),
+		Selected: common.GetDevice(),
+	}
+	for idx, device := range devices {
+		data.Devices[idx] = AudioDeviceModel{
+			Id:   device.ID,
+			Name: device.Name,
+		}
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// Select audio device
+// (POST /system/device)
+func (s Server) PostSystemDevice(w http.ResponseWriter, r *http.Request) {
+	var selection PostSystemDeviceJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&selection); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+	err := common.SetDevice(selection.Device)
+	if errors.Is(err, common.ErrDeviceNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	} else if errors.Is(err, common.ErrDevicesUnsupported) {
+		render.Status(r, http.StatusNotImplemented)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Get output processing
+// (GET /system/output)
+func (s Server) GetSystemOutput(w http.ResponseWriter, r *http.Request) {
+	settings := common.GetOutput()
+	eq := make([]EQBandModel, len(settings.EQ))
+	for idx, band := range settings.EQ {
+		eq[idx] = EQBandModel{
+			Type: band.Type,
+			Freq: float32(band.Freq),
+			Gain: float32(band.Gain),
+		}
+		if band.Q != 0 {
+			q := float32(band.Q)
+			eq[idx].Q = &q
+		}
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, OutputModel{
+		Eq:             eq,
+		BassBoost:      float32(settings.BassBoost),
+		BassBoostFreq:  float32(settings.BassBoostFreq),
+		Limiter:        settings.Limiter,
+		LimiterCeiling: float32(settings.LimiterCeiling),
+		LimiterRelease: settings.LimiterRelease,
+	})
+}
+
+// Set output processing
+// (POST /system/output)
+func (s Server) PostSystemOutput(w http.ResponseWriter, r *http.Request) {
+	var out PostSystemOutputJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&out); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, "NOK")
+		return
+	}
+	settings := common.OutputSettings{
+		EQ:             make([]common.EQBand, len(out.Eq)),
+		BassBoost:      float64(out.BassBoost),
+		BassBoostFreq:  float64(out.BassBoostFreq),
+		Limiter:        out.Limiter,
+		LimiterCeiling: float64(out.LimiterCeiling),
+		LimiterRelease: out.LimiterRelease,
+	}
+	for idx, band := range out.Eq {
+		settings.EQ[idx] = common.EQBand{
+			Type: band.Type,
+			Freq: float64(band.Freq),
+			Gain: float64(band.Gain),
+		}
+		if band.Q != nil {
+			settings.EQ[idx].Q = float64(*band.Q)
+		}
+	}
+	err := common.SetOutput(settings)
+	if errors.Is(err, common.ErrFilterInvalid) {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
 // Get Intensity
 // (GET /system/intensity)
 func (s Server) GetSystemIntensity(w http.ResponseWriter, r *http.Request) {
@@ -552,6 +1097,53 @@ func (s Server) PostSystemIntensityDelta(w http.ResponseWriter, r *http.Request,
 	render.JSON(w, r, "OK")
 }
 
+// Get Schedule
+// (GET /system/schedule)
+func (s Server) GetSystemSchedule(w http.ResponseWriter, r *http.Request) {
+	status := common.GetSchedule()
+	data := ScheduleModel{
+		State:  ScheduleModelState(status.State),
+		Target: status.Target,
+	}
+	if !status.Started.IsZero() {
+		data.Started = &status.Started
+	}
+	if !status.Next.IsZero() {
+		data.Next = &status.Next
+		data.NextIntensity = &status.NextIntensity
+	}
+	if !status.Resume.IsZero() {
+		data.Resume = &status.Resume
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, data)
+}
+
+// Start Schedule
+// (POST /system/schedule/start)
+func (s Server) PostSystemScheduleStart(w http.ResponseWriter, r *http.Request) {
+	err := common.StartSchedule()
+	if errors.Is(err, common.ErrScheduleEmpty) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, err.Error())
+		return
+	} else if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, err.Error())
+		return
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
+// Pause Schedule
+// (POST /system/schedule/pause)
+func (s Server) PostSystemSchedulePause(w http.ResponseWriter, r *http.Request) {
+	common.PauseSchedule()
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, "OK")
+}
+
 // Ping
 // (GET /ping)
 func (s Server) GetPing(w http.ResponseWriter, r *http.Request) {
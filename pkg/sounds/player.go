@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dulli/deichwave/pkg/common"
 	log "github.com/sirupsen/logrus"
@@ -25,20 +27,32 @@ type SoundPlayer interface {
 	ListSounds() []string
 	GetSound(name string) (Sound, error)
 	LoadSounds(root string) error
+	Rescan() error
 }
 
 // The player keeps track of the available and looped sounds
 type soundPlayer struct {
-	Name    string
-	list    soundList
-	rate    beep.SampleRate
-	quality int
-	ext     string
-	rnd     string
-	volume  int
+	Name     string
+	list     soundList
+	rate     beep.SampleRate
+	quality  int
+	ext      string
+	rnd      string
+	root     string
+	buffers  map[string]cachedBuffer
+	lock     sync.RWMutex
+	scanLock sync.Mutex
 }
 type soundList map[string]Sound
 
+// Buffered files are kept, so that a rescan only has to decode new or
+// changed files
+type cachedBuffer struct {
+	size     int64
+	modified time.Time
+	buffer   *beep.Buffer
+}
+
 // NewPlayer returns a new SoundPlayer object with the given name
 // according to the provided config. (see pkg/common/config.go)
 func NewPlayer(name string, cfg common.Config) (SoundPlayer, error) {
@@ -49,15 +63,17 @@ func NewPlayer(name string, cfg common.Config) (SoundPlayer, error) {
 		quality: cfg.Audio.Quality,
 		ext:     cfg.Sounds.Ext,
 		rnd:     cfg.Sounds.Randomizer,
-		volume:  cfg.Sounds.Volume,
+		buffers: make(map[string]cachedBuffer),
 	}
-	_, err := common.GetSpeaker(player.rate, cfg.Audio.Buffer, cfg.Audio.Volume)
+	_, err := common.GetSpeaker(player.rate, cfg.Audio.Buffer, cfg.Audio.Volume, cfg.Audio.Device)
 	return &player, err
 }
 
 // ListSounds gathers all available sound names and returns them as a slice
 // of strings.
 func (p *soundPlayer) ListSounds() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	sounds := make([]string, 0)
 	for key, sound := range p.list {
 		if !sound.getSystem() {
@@ -70,6 +86,8 @@ func (p *soundPlayer) ListSounds() []string {
 
 // GetSound returns the playable sound object for the given sound name.
 func (p *soundPlayer) GetSound(name string) (Sound, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	if val, ok := p.list[name]; ok {
 		return val, nil
 	}
@@ -81,13 +99,71 @@ func (p *soundPlayer) GetSound(name string) (Sound, error) {
 // audio files in that directory are added to a sound group. Any top-
 // level audio files are added as individual sounds.
 func (p *soundPlayer) LoadSounds(root string) error {
-	root = filepath.Clean(root)
+	p.root = filepath.Clean(root)
+	list, err := p.scan(p.root)
+	p.lock.Lock()
+	p.list = list
+	p.lock.Unlock()
+	return err
+}
+
+// Rescan compares the sound directory with the loaded sounds and adds,
+// updates or removes sounds accordingly. Sounds that are currently playing
+// are not interrupted, looped sounds keep looping unless they were removed.
+func (p *soundPlayer) Rescan() error {
+	list, err := p.scan(p.root)
+	if err != nil {
+		return err
+	}
+
+	added, removed := 0, 0
+	p.lock.Lock()
+	for name, s := range list {
+		if old, ok := p.list[name]; ok {
+			old.setBuffers(s.getBuffers())
+			old.setSelector(s.getSelector())
+		} else {
+			p.list[name] = s
+			added += 1
+		}
+	}
+	for name, s := range p.list {
+		if _, ok := list[name]; !ok {
+			s.Unloop()
+			delete(p.list, name)
+			removed += 1
+		}
+	}
+	p.lock.Unlock()
+
+	log.WithFields(log.Fields{
+		"added":   added,
+		"removed": removed,
+	}).Info("Rescanned the sounds")
+	common.EventFire(common.Event{
+		Origin: "sounds",
+		Type:   "rescan",
+	})
+	return nil
+}
+
+// scan crawls the sound directory and returns all sounds it contains
+func (p *soundPlayer) scan(root string) (soundList, error) {
+	p.scanLock.Lock()
+	defer p.scanLock.Unlock()
+
+	list := make(soundList)
+	seen := make(map[string]bool)
+	load := func(path string) (*beep.Buffer, error) {
+		seen[path] = true
+		return p.loadCached(path)
+	}
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		s, err := visit(root, p.ext, p.rnd, p.rate, p.quality, p.volume, path, d.IsDir())
+		s, err := visit(root, p.ext, p.rnd, load, path, d.IsDir())
 		if err != nil {
 			return err
 		}
@@ -98,20 +174,20 @@ func (p *soundPlayer) LoadSounds(root string) error {
 		// Now we just have to check whether we have a new sound or one that is part of a group
 		// which has already been added, in that case the selector is driven by the first sound added
 		// and can only be overwritten using a randomizer
-		if _, ok := p.list[s.GetName()]; ok {
+		if _, ok := list[s.GetName()]; ok {
 			if s.getSelector() == SELECT_RANDOM {
-				p.list[s.GetName()].setSelector(SELECT_RANDOM)
+				list[s.GetName()].setSelector(SELECT_RANDOM)
 				log.WithFields(log.Fields{
 					"name": s.GetName(),
 				}).Debug("Randomized group")
 			} else {
-				p.list[s.GetName()].addBuffers(s.getBuffers())
+				list[s.GetName()].addBuffers(s.getBuffers())
 				log.WithFields(log.Fields{
 					"name": s.GetName(),
 				}).Debug("Added buffer to group")
 			}
 		} else {
-			p.list[s.GetName()] = s
+			list[s.GetName()] = s
 			log.WithFields(log.Fields{
 				"name": s.GetName(),
 			}).Debug("Added sound")
@@ -119,7 +195,33 @@ func (p *soundPlayer) LoadSounds(root string) error {
 
 		return err
 	})
-	return err
+
+	// Forget the buffers of files that no longer exist
+	for path := range p.buffers {
+		if !seen[path] {
+			delete(p.buffers, path)
+		}
+	}
+	return list, err
+}
+
+// loadCached returns the buffer of a file that has already been loaded if it
+// did not change since, otherwise the file is buffered again
+func (p *soundPlayer) loadCached(path string) (*beep.Buffer, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := p.buffers[path]; ok && cached.size == stat.Size() && cached.modified.Equal(stat.ModTime()) {
+		return cached.buffer, nil
+	}
+
+	buffer, err := loadFile(path, p.rate, p.quality)
+	if err != nil {
+		return nil, err
+	}
+	p.buffers[path] = cachedBuffer{size: stat.Size(), modified: stat.ModTime(), buffer: buffer}
+	return buffer, nil
 }
 
 // visit is called on all elements encountered while crawling a
@@ -128,9 +230,7 @@ func visit(
 	root string,
 	ext string,
 	randomizer string,
-	rate beep.SampleRate,
-	quality int,
-	volume int,
+	load func(path string) (*beep.Buffer, error),
 	currentPath string,
 	isDir bool,
 ) (Sound, error) {
@@ -145,14 +245,14 @@ func visit(
 	if isDir {
 		if parent == "" {
 			// If the current element is a folder in the uppermost level, create a new sound group
-			return NewSound(element, make(bufferList, 0), SELECT_SEQUENCE, volume), nil
+			return NewSound(element, make(bufferList, 0), SELECT_SEQUENCE), nil
 		} else {
 			// otherwise skip this folder, as we don't expect subfolders to exist
 			return nil, fs.SkipDir
 		}
 	} else if element == randomizer {
 		// If the current element is a file named after the magic randomizer string, return a randomizer
-		return NewSound(parent, make(bufferList, 0), SELECT_RANDOM, volume), nil
+		return NewSound(parent, make(bufferList, 0), SELECT_RANDOM), nil
 	} else if filepath.Ext(currentPath) == ext {
 		// If the current element is a file with the correct file extension, add it as a sound
 		// where the name is either the filename or the parent folders name
@@ -163,11 +263,11 @@ func visit(
 		}
 
 		// If we got this far, the file is actually a sound file we want to add so we can buffer it
-		buffer, err := loadFile(currentPath, rate, quality)
+		buffer, err := load(currentPath)
 		if err != nil {
 			return nil, err
 		}
-		return NewSound(element, bufferList{buffer}, SELECT_SINGLE, volume), nil
+		return NewSound(element, bufferList{buffer}, SELECT_SINGLE), nil
 	}
 	return nil, nil
 }
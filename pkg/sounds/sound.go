@@ -1,9 +1,9 @@
 package sounds
 
 import (
-	"math"
 	"math/rand"
 	"strings"
+	"sync"
 
 	"github.com/dulli/deichwave/pkg/common"
 	"github.com/faiface/beep"
@@ -24,11 +24,15 @@ type Sound interface {
 	Loop()
 	Unloop()
 	GetName() string
+	GetVolume() int
+	SetVolume(volume int)
+	ChangeVolume(delta int)
 	getSystem() bool
 	getSelector() int
 	setSelector(selector int)
 	getBuffers() bufferList
 	addBuffers(buffers bufferList)
+	setBuffers(buffers bufferList)
 	GetBufferCount() int
 }
 
@@ -40,34 +44,36 @@ type sound struct {
 	Selector int
 	index    int
 	loop     *beep.Ctrl
-	volume   int
+	loopVol  *effects.Volume
+	lock     sync.Mutex
 }
 type bufferList []*beep.Buffer
 
 // NewSound returns a new playable sound object with a given name,
 // a list of buffers and the method used to select one of the buffers
 // when the song is played.
-func NewSound(name string, buffers bufferList, selector int, volume int) Sound {
+func NewSound(name string, buffers bufferList, selector int) Sound {
 	isSystem := false
 	if strings.HasSuffix(name, ".system") {
 		isSystem = true
 		name = strings.TrimSuffix(name, ".system")
 	}
-	return &sound{Name: name, system: isSystem, Buffers: buffers, Selector: selector, volume: volume}
+	return &sound{Name: name, system: isSystem, Buffers: buffers, Selector: selector}
 }
 
 // Play starts playback of the next buffer that is to be played according
 // to the selector method attached to the ssound.
 func (s *sound) Play() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.Buffers) == 0 {
+		return
+	}
 	buffer := s.Buffers[s.index]
 	streamer := buffer.Streamer(0, buffer.Len())
-	volume := &effects.Volume{
-		Streamer: streamer,
-		Base:     2,
-		Volume:   math.Log2(float64(s.volume) / 100),
-		Silent:   false,
-	}
-	common.Play(volume)
+	volume := &effects.Volume{Streamer: streamer, Base: 2}
+	common.ApplyVolume(volume, common.GetSoundVolume(s.Name))
+	common.PlaySound(s.Name, volume)
 	log.WithFields(log.Fields{
 		"name":  s.Name,
 		"index": s.index,
@@ -85,17 +91,15 @@ func (s *sound) Play() {
 
 // Loop starts and indefinitely loops the next buffer.
 func (s *sound) Loop() {
-	if s.loop == nil {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.loop == nil && len(s.Buffers) > 0 {
 		buffer := s.Buffers[s.index]
 		streamer := buffer.Streamer(0, buffer.Len())
 		s.loop = &beep.Ctrl{Streamer: beep.Loop(-1, streamer), Paused: false}
-		volume := &effects.Volume{
-			Streamer: s.loop,
-			Base:     2,
-			Volume:   math.Log2(float64(s.volume) / 100),
-			Silent:   false,
-		}
-		common.Play(volume)
+		s.loopVol = &effects.Volume{Streamer: s.loop, Base: 2}
+		common.ApplyVolume(s.loopVol, common.GetSoundVolume(s.Name))
+		common.PlaySound(s.Name, s.loopVol)
 
 		log.WithFields(log.Fields{
 			"name":  s.Name,
@@ -106,10 +110,13 @@ func (s *sound) Loop() {
 
 // Unloop stops the currently looped buffer.
 func (s *sound) Unloop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if s.loop != nil {
 		speaker.Lock()
 		s.loop.Streamer = nil
 		s.loop = nil
+		s.loopVol = nil
 		speaker.Unlock()
 
 		log.WithFields(log.Fields{
@@ -123,6 +130,28 @@ func (s *sound) GetName() string {
 	return s.Name
 }
 
+// GetVolume returns the volume of the sound relative to the other sounds
+func (s *sound) GetVolume() int {
+	return common.GetSoundVolume(s.Name)
+}
+
+// SetVolume changes the volume of the sound, which also applies to it while
+// it is looped
+func (s *sound) SetVolume(volume int) {
+	volume = common.SetSoundVolume(s.Name, volume)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.loopVol != nil {
+		speaker.Lock()
+		common.ApplyVolume(s.loopVol, volume)
+		speaker.Unlock()
+	}
+}
+
+func (s *sound) ChangeVolume(delta int) {
+	s.SetVolume(s.GetVolume() + delta)
+}
+
 func (s *sound) getSystem() bool {
 	return s.system
 }
@@ -136,13 +165,29 @@ func (s *sound) setSelector(selector int) {
 }
 
 func (s *sound) getBuffers() bufferList {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return s.Buffers
 }
 
 func (s *sound) addBuffers(buffers bufferList) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.Buffers = append(s.Buffers, buffers...)
 }
 
+// setBuffers replaces all buffers of the sound, a looped buffer keeps playing
+func (s *sound) setBuffers(buffers bufferList) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Buffers = buffers
+	if s.index >= len(s.Buffers) {
+		s.index = 0
+	}
+}
+
 func (s *sound) GetBufferCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	return len(s.Buffers)
 }
@@ -88,23 +88,28 @@ function init_site() {
     }
     Alpine.store('profiles', profiles)
 
-    volume = {
-        level: 0,
-        async init() {
-            await this.update()
-        },
-        async update() {
-            r = await api('system/volume')
-            this.level = r['level']
-        },
-        async set(ev) {
-            vol = parseInt(ev.target.value)
-            if (this.level != vol) {
-                this.level = vol
-                await api('system/volume', 'post', { level: this.level })
-            }
-        },
+    function volumeChannel(endpoint) {
+        return {
+            level: 0,
+            async init() {
+                await this.update()
+            },
+            async update() {
+                r = await api(endpoint)
+                this.level = r['level']
+            },
+            async set(ev) {
+                vol = parseInt(ev.target.value)
+                if (this.level != vol) {
+                    this.level = vol
+                    await api(endpoint, 'post', { level: this.level })
+                }
+            },
+        }
     }
+    volume = volumeChannel('system/volume')
+    musicVolume = volumeChannel('system/volume/music')
+    soundsVolume = volumeChannel('system/volume/sounds')
 
     intensity = {
         level: 0,
@@ -125,6 +130,8 @@ function init_site() {
     }
 
     Alpine.store('volume', volume)
+    Alpine.store('musicVolume', musicVolume)
+    Alpine.store('soundsVolume', soundsVolume)
     Alpine.store('intensity', intensity)
 
     selectedEffect = ''
@@ -167,6 +174,7 @@ function init_site() {
         },
         async update() {
             r = await api('music')
+            this.lists.length = r['entity'].length
             for (const [index, playlist] of r['entity'].entries()) {
                 this.lists[index] = {
                     name: playlist,
@@ -202,15 +210,30 @@ function init_site() {
         info: {
             title: '',
             artist: '',
-            image: '',
+            cover: '',
             playlist: '',
         },
+        lyric: '',
         async init() {
             await this.update()
         },
         async update() {
             r = await api('music/playing')
             this.info = r
+            this.lyric = ''
+        },
+        cover(size) {
+            if (!this.info.cover) return ''
+            return `${basehost}api/v0/${this.info.cover}&size=${size}`
+        },
+        progress(data) {
+            this.info.elapsed = data.elapsed
+            this.info.total = data.total
+        },
+        async seek(ev) {
+            rect = ev.target.getBoundingClientRect()
+            position = ((ev.clientX - rect.left) / rect.width) * this.info.total
+            await api('music/seek', 'post', { position })
         },
     }
 
@@ -284,14 +307,28 @@ async function subscribe_events(host = undefined) {
         if (all || (data.origin == 'music' && data.type == 'playing')) {
             Alpine.store('playing').update()
         }
+        if (data.origin == 'music' && data.type == 'progress') {
+            Alpine.store('playing').progress(data.data)
+        }
+        if (data.origin == 'music' && data.type == 'lyrics') {
+            Alpine.store('playing').lyric = data.data.text
+        }
         if (all || (data.origin == 'music' && data.type == 'position')) {
             Alpine.store('playlists').updatePositions(data.name)
         }
         if (all || (data.origin == 'music' && data.type == 'shuffle')) {
             Alpine.store('playlists').updateSongs(data.name)
         }
+        if (data.origin == 'music' && data.type == 'rescan') {
+            Alpine.store('playlists').init()
+        }
+        if (data.origin == 'sounds' && data.type == 'rescan') {
+            Alpine.store('sounds').update()
+        }
         if (all || (data.origin == 'audio' && data.type == 'volume')) {
-            Alpine.store('volume').update()
+            if (all || !data.name) Alpine.store('volume').update()
+            if (all || data.name == 'music') Alpine.store('musicVolume').update()
+            if (all || data.name == 'sounds') Alpine.store('soundsVolume').update()
         }
         if (all || (data.origin == 'audio' && data.type == 'intensity')) {
             Alpine.store('playlists').updateChances()